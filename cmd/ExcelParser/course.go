@@ -0,0 +1,109 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Импорт курса из книги Excel. Имя первого листа — название курса.
+// Строки "#описание | текст" и "#auto | true" задают описание курса и
+// автоматический переход к следующему упражнению. Далее: непустая первая
+// колонка начинает новый юнит, вторая колонка — название упражнения,
+// которое добавляется в текущий юнит. Повторный импорт заменяет юниты курса.
+func importCourse(db *sql.DB, path string) {
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	title := f.GetSheetName(0)
+	rows, err := f.GetRows(title)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	description := ""
+	autoAdvance := false
+	for _, row := range rows {
+		if len(row) < 2 || !isMetaRow(row) {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(row[0]), "#")), ":"))
+		switch key {
+		case "description", "описание":
+			description = strings.TrimSpace(row[1])
+		case "auto", "автопереход":
+			autoAdvance = strings.EqualFold(strings.TrimSpace(row[1]), "true")
+		default:
+			log.Printf("Неизвестный ключ курса %q пропущен", row[0])
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO Course (title, description, auto_advance) VALUES (?, ?, ?)
+		ON CONFLICT(title) DO UPDATE SET description = excluded.description, auto_advance = excluded.auto_advance`,
+		title, description, autoAdvance)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var courseID int64
+	if err := tx.QueryRow(`SELECT id FROM Course WHERE title = ?`, title).Scan(&courseID); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := tx.Exec(`DELETE FROM CourseExercise WHERE unit_id IN (SELECT id FROM CourseUnit WHERE course_id = ?)`, courseID); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := tx.Exec(`DELETE FROM CourseUnit WHERE course_id = ?`, courseID); err != nil {
+		log.Fatal(err)
+	}
+
+	var unitID int64
+	unitPos, exercisePos := 0, 0
+	for rowIdx, row := range rows {
+		if len(row) < 1 || isMetaRow(row) {
+			continue
+		}
+		if unitTitle := strings.TrimSpace(row[0]); unitTitle != "" {
+			unitPos++
+			exercisePos = 0
+			res, err := tx.Exec(`INSERT INTO CourseUnit (course_id, position, title) VALUES (?, ?, ?)`,
+				courseID, unitPos, unitTitle)
+			if err != nil {
+				log.Fatalf("Ошибка вставки юнита на строке %d: %v", rowIdx+1, err)
+			}
+			unitID, err = res.LastInsertId()
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if len(row) < 2 || strings.TrimSpace(row[1]) == "" {
+			continue
+		}
+		if unitID == 0 {
+			log.Fatalf("Строка %d: упражнение указано до первого юнита", rowIdx+1)
+		}
+		var exerciseID int64
+		err := tx.QueryRow(`SELECT id FROM Exercise WHERE title = ?`, strings.TrimSpace(row[1])).Scan(&exerciseID)
+		if err == sql.ErrNoRows {
+			log.Fatalf("Строка %d: упражнение %q не найдено", rowIdx+1, row[1])
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		exercisePos++
+		if _, err := tx.Exec(`INSERT INTO CourseExercise (unit_id, exercise_id, position) VALUES (?, ?, ?)`,
+			unitID, exerciseID, exercisePos); err != nil {
+			log.Fatalf("Ошибка вставки упражнения курса на строке %d: %v", rowIdx+1, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatal(err)
+	}
+}
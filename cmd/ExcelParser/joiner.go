@@ -0,0 +1,63 @@
+package main
+
+import (
+	"log"
+	"strings"
+)
+
+// Третья колонка строки подвопроса — как часть присоединяется к предложению.
+// "true" — старый формат: вставка как есть, без ответа ученика.
+var joinerKeys = map[string]string{
+	"word":        "word",
+	"слово":       "word",
+	"suffix":      "suffix",
+	"аффикс":      "suffix",
+	"punct":       "punct",
+	"знак":        "punct",
+	"clause":      "clause",
+	"предложение": "clause",
+}
+
+// Направление перевода. По умолчанию строка — часть татарского перевода;
+// строки с флагом ru/рус — русская разбивка для обратного направления
+// (татарский → русский). Флаги пишутся через пробел или запятую: "ru word".
+var directionKeys = map[string]string{
+	"tt":  "tt",
+	"тат": "tt",
+	"ru":  "ru",
+	"рус": "ru",
+}
+
+// разобрать третью колонку: pointing, joiner и направление перевода
+func parseSubQuestionFlags(cell string) (int, string, string) {
+	pointing, joiner, direction := 0, "", "tt"
+	for _, flag := range strings.FieldsFunc(cell, func(r rune) bool { return r == ' ' || r == ',' }) {
+		if value, ok := directionKeys[strings.ToLower(flag)]; ok {
+			direction = value
+			continue
+		}
+		pointing, joiner = parseJoiner(flag)
+	}
+	return pointing, joiner, direction
+}
+
+// разобрать тип подвопроса: pointing (1 — вставляется без ответа) и joiner
+func parseJoiner(cell string) (int, string) {
+	value := strings.ToLower(strings.TrimSpace(cell))
+	switch value {
+	case "":
+		return 0, ""
+	case "true":
+		return 1, ""
+	}
+	joiner, ok := joinerKeys[value]
+	if !ok {
+		log.Printf("Неизвестный тип подвопроса %q, часть вставляется как есть", cell)
+		return 0, ""
+	}
+	// знаки препинания ученик не выбирает
+	if joiner == "punct" {
+		return 1, joiner
+	}
+	return 0, joiner
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+)
+
+// Раскладка листа с вопросами зависит от типа упражнения (#тип | ...):
+//
+//	предложение, порядок — строка вопроса, затем строки частей перевода
+//	                       (колонка B — часть, C — флаги, D… — варианты);
+//	выбор                — одна строка: A — вопрос, B — ответ, C… — неверные варианты;
+//	пропуски             — одна строка: A — предложение с пропусками
+//	                       [ответ|неверный|неверный], B — подсказка или перевод;
+//	пары                 — строка задания в A, затем строки пар: B — левая часть,
+//	                       C — правая; варианты — все правые части задания.
+var layouts = map[string]func(db *sql.DB, title string, rows [][]string){
+	"":       importSentenceRows,
+	"order":  importSentenceRows,
+	"choice": importChoiceRows,
+	"cloze":  importClozeRows,
+	"match":  importMatchRows,
+}
+
+// subQuestion — строка SubQuestion для вставки
+type subQuestion struct {
+	Pointing  int
+	Joiner    string
+	Direction string
+	Prompt    string
+	Text      string
+}
+
+func insertQuestion(db *sql.DB, title string, text string, rowIdx int) int64 {
+	res, err := db.Exec(`INSERT INTO Question (exercise_id, text)
+		VALUES ((SELECT id FROM Exercise WHERE title = ?), ?)`, title, text)
+	if err != nil {
+		log.Fatalf("Ошибка вставки Question на строке %d: %v", rowIdx+1, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return id
+}
+
+func insertSubQuestion(db *sql.DB, questionID int64, seq int, sub subQuestion, rowIdx int) int64 {
+	if sub.Direction == "" {
+		sub.Direction = "tt"
+	}
+	res, err := db.Exec(`INSERT INTO SubQuestion (question_id, seq_num, pointing, joiner, direction, prompt, text)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		questionID, seq, sub.Pointing, sub.Joiner, sub.Direction, sub.Prompt, sub.Text)
+	if err != nil {
+		log.Fatalf("Ошибка вставки SubQuestion на строке %d: %v", rowIdx+1, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return id
+}
+
+func insertOptions(db *sql.DB, subQuestionID int64, options []string, rowIdx int) {
+	for _, text := range options {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		if _, err := db.Exec(`INSERT INTO Option (sub_question_id, text) VALUES (?, ?)`, subQuestionID, text); err != nil {
+			log.Fatalf("Ошибка вставки Option на строке %d: %v", rowIdx+1, err)
+		}
+	}
+}
+
+// строки, которые не относятся к вопросам
+func skipRow(row []string) bool {
+	return len(row) < 1 || isMetaRow(row)
+}
+
+// сборка перевода и порядок слов: вопрос и строки его частей
+func importSentenceRows(db *sql.DB, title string, rows [][]string) {
+	var currentQuestionID int64
+	subQuestionSeq := 1
+	for rowIdx, row := range rows {
+		if skipRow(row) {
+			continue
+		}
+		// ---------- Question ----------
+		if strings.TrimSpace(row[0]) != "" {
+			currentQuestionID = insertQuestion(db, title, strings.TrimSpace(row[0]), rowIdx)
+			subQuestionSeq = 1 // сбрасываем seq_num для нового вопроса
+			continue
+		}
+		// ---------- SubQuestion ----------
+		if len(row) < 2 || row[1] == "" {
+			continue
+		}
+		sub := subQuestion{Text: row[1]}
+		if len(row) >= 3 {
+			sub.Pointing, sub.Joiner, sub.Direction = parseSubQuestionFlags(row[2])
+		}
+		subQuestionID := insertSubQuestion(db, currentQuestionID, subQuestionSeq, sub, rowIdx)
+		subQuestionSeq++
+		// ---------- Options ----------
+		if len(row) >= 4 {
+			insertOptions(db, subQuestionID, row[3:], rowIdx)
+		}
+	}
+}
+
+// выбор одного ответа: вопрос, ответ и неверные варианты в одной строке
+func importChoiceRows(db *sql.DB, title string, rows [][]string) {
+	for rowIdx, row := range rows {
+		if skipRow(row) || strings.TrimSpace(row[0]) == "" {
+			continue
+		}
+		if len(row) < 3 {
+			log.Fatalf("Строка %d: нужны вопрос, ответ и хотя бы один неверный вариант", rowIdx+1)
+		}
+		questionID := insertQuestion(db, title, strings.TrimSpace(row[0]), rowIdx)
+		answer := strings.TrimSpace(row[1])
+		subQuestionID := insertSubQuestion(db, questionID, 1, subQuestion{Text: answer}, rowIdx)
+		insertOptions(db, subQuestionID, row[1:], rowIdx)
+	}
+}
+
+// clozePart — кусок предложения с пропусками
+type clozePart struct {
+	Text    string   // видимый текст или правильный ответ пропуска
+	Options []string // варианты пропуска; nil — видимый текст
+}
+
+// разобрать "Мин [укы|яз]ым" на видимый текст и пропуски
+func parseCloze(sentence string) ([]clozePart, bool) {
+	var parts []clozePart
+	for sentence != "" {
+		open := strings.IndexByte(sentence, '[')
+		if open < 0 {
+			parts = append(parts, clozePart{Text: sentence})
+			break
+		}
+		end := strings.IndexByte(sentence[open:], ']')
+		if end < 0 {
+			return nil, false
+		}
+		if open > 0 {
+			parts = append(parts, clozePart{Text: sentence[:open]})
+		}
+		options := strings.Split(sentence[open+1:open+end], "|")
+		answer := strings.TrimSpace(options[0])
+		if answer == "" {
+			return nil, false
+		}
+		parts = append(parts, clozePart{Text: answer, Options: options})
+		sentence = sentence[open+end+1:]
+	}
+	return parts, true
+}
+
+// пропуски: предложение с [ответ|неверный] и подсказка
+func importClozeRows(db *sql.DB, title string, rows [][]string) {
+	for rowIdx, row := range rows {
+		if skipRow(row) || strings.TrimSpace(row[0]) == "" {
+			continue
+		}
+		parts, ok := parseCloze(strings.TrimSpace(row[0]))
+		if !ok {
+			log.Fatalf("Строка %d: пропуск должен выглядеть как [ответ|неверный вариант]", rowIdx+1)
+		}
+		hint := ""
+		if len(row) >= 2 {
+			hint = strings.TrimSpace(row[1])
+		}
+		questionID := insertQuestion(db, title, hint, rowIdx)
+		for i, part := range parts {
+			sub := subQuestion{Text: part.Text}
+			if part.Options == nil {
+				sub.Pointing = 1
+			}
+			subQuestionID := insertSubQuestion(db, questionID, i+1, sub, rowIdx)
+			insertOptions(db, subQuestionID, part.Options, rowIdx)
+		}
+	}
+}
+
+// пары: строка задания, затем пары «левая часть — правая часть»
+func importMatchRows(db *sql.DB, title string, rows [][]string) {
+	var questionID int64
+	var pairs []int64    // подвопросы текущего задания
+	var answers []string // правые части — варианты для каждой пары
+	flush := func(rowIdx int) {
+		for _, subQuestionID := range pairs {
+			insertOptions(db, subQuestionID, answers, rowIdx)
+		}
+		pairs, answers = nil, nil
+	}
+	for rowIdx, row := range rows {
+		if skipRow(row) {
+			continue
+		}
+		if strings.TrimSpace(row[0]) != "" {
+			flush(rowIdx)
+			questionID = insertQuestion(db, title, strings.TrimSpace(row[0]), rowIdx)
+			continue
+		}
+		if len(row) < 3 || strings.TrimSpace(row[2]) == "" {
+			continue
+		}
+		sub := subQuestion{Prompt: strings.TrimSpace(row[1]), Text: strings.TrimSpace(row[2])}
+		pairs = append(pairs, insertSubQuestion(db, questionID, len(pairs)+1, sub, rowIdx))
+		answers = append(answers, sub.Text)
+	}
+	flush(len(rows))
+}
@@ -9,6 +9,8 @@ import (
 
 	"github.com/xuri/excelize/v2"
 	_ "modernc.org/sqlite"
+
+	"LinguisticCombinatorics/internal/schema"
 )
 
 func main() {
@@ -22,8 +24,8 @@ func main() {
 	textExercise := strings.Join(os.Args[2:], " ") // всё после первого аргумента
 
 	// проверка команды
-	if command != "new" && command != "replace" && command != "add" {
-		fmt.Println("Поддерживаются команды: new, replace, add")
+	if command != "new" && command != "replace" && command != "add" && command != "course" {
+		fmt.Println("Поддерживаются команды: new, replace, add, course")
 		return
 	}
 
@@ -42,8 +44,13 @@ func main() {
 		log.Fatal(err)
 	}
 	defer db.Close()
-	fmt.Printf(text)
+	if err := schema.Ensure(db); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(text)
 	switch command {
+	case "course":
+		importCourse(db, text+".xlsx")
 	case "new":
 		qRes, err := db.Exec(
 			`INSERT INTO Exercise (title) VALUES (?)`,
@@ -52,10 +59,11 @@ func main() {
 		if err != nil {
 			log.Fatal(err)
 		}
-		questionID, _ := qRes.LastInsertId()
+		exerciseID, err := qRes.LastInsertId()
 		if err != nil {
-			log.Printf(string(questionID))
+			log.Fatal(err)
 		}
+		log.Printf("id упражнения: %d", exerciseID)
 	case "add":
 		// --- Excel ---
 		f, err := excelize.OpenFile(text + ".xlsx")
@@ -63,81 +71,25 @@ func main() {
 			log.Fatal(err)
 		}
 
-		sheetName := f.GetSheetName(0)
+		sheetName := exerciseSheet(f)
 		rows, err := f.GetRows(sheetName)
 		if err != nil {
 			log.Fatal(err)
 		}
 
+		// ---------- метаданные упражнения ----------
+		meta := readMeta(f, rows)
+		applyMeta(db, sheetName, meta)
+
 		if len(rows) < 2 {
 			log.Fatal("недостаточно строк в Excel")
 		}
 
-		var currentQuestionID int64
-		subQuestionSeq := 1
-		for rowIdx, row := range rows {
-			if len(row) < 1 {
-				continue // пропускаем пустые или короткие строки
-			}
-
-			// ---------- Question ----------
-			if strings.TrimSpace(row[0]) != "" {
-				questionText := strings.TrimSpace(row[0])
-
-				res, err := db.Exec(`INSERT INTO Question (exercise_id, text)
-    				VALUES ((SELECT id FROM Exercise WHERE title = ?),?)`, sheetName, questionText)
-				if err != nil {
-					log.Fatalf("Ошибка вставки Question на строке %d: %v", rowIdx+1, err)
-				}
-				currentQuestionID, err = res.LastInsertId()
-				if err != nil {
-					log.Fatal(err)
-				}
-				subQuestionSeq = 1 // сбрасываем seq_num для нового вопроса
-				continue
-			}
-			// ---------- SubQuestion ----------
-			subText := row[1]
-			pointing := 0
-			if len(row) >= 3 && strings.ToLower(strings.TrimSpace(row[2])) == "true" {
-				pointing = 1
-			}
-
-			var subQuestionID int64
-			if subText != "" {
-				res, err := db.Exec(
-					`INSERT INTO SubQuestion (question_id, seq_num, pointing, text)
-				 VALUES (?, ?, ?, ?)`,
-					currentQuestionID, subQuestionSeq, pointing, subText,
-				)
-				if err != nil {
-					log.Fatalf("Ошибка вставки SubQuestion на строке %d: %v", rowIdx+1, err)
-				}
-				subQuestionID, err = res.LastInsertId()
-				if err != nil {
-					log.Fatal(err)
-				}
-				subQuestionSeq++
-			}
-			// ---------- Options ----------
-			if len(row) >= 4 && subQuestionID != 0 {
-				for col := 3; col < len(row); col++ {
-					optText := strings.TrimSpace(row[col])
-					if optText == "" {
-						continue
-					}
-
-					_, err := db.Exec(
-						`INSERT INTO Option (sub_question_id, text)
-					 VALUES (?, ?)`,
-						subQuestionID, optText)
-					if err != nil {
-						log.Fatalf("Ошибка вставки Option на строке %d, колонка %d: %v", rowIdx+1, col+1, err)
-					}
-				}
-			}
+		importRows, ok := layouts[exerciseTypeOf(meta)]
+		if !ok {
+			log.Fatalf("Нет раскладки листа для типа упражнения %q", meta["type"])
 		}
-
+		importRows(db, sheetName, rows)
 	}
 	fmt.Printf("Новая запись в таблице успешно добавлена")
 
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Названия листа с метаданными упражнения
+var metaSheetNames = []string{"meta", "метаданные"}
+
+// Синонимы ключей метаданных → колонка Exercise
+var metaKeys = map[string]string{
+	"level":       "level",
+	"уровень":     "level",
+	"position":    "position",
+	"порядок":     "position",
+	"позиция":     "position",
+	"description": "description",
+	"описание":    "description",
+	"topic":       "topic",
+	"тема":        "topic",
+	"questions":   "question_count",
+	"вопросов":    "question_count",
+	"mode":        "answer_mode",
+	"режим":       "answer_mode",
+	"unlock":      "unlock_accuracy",
+	"порог":       "unlock_accuracy",
+	"type":        "type",
+	"тип":         "type",
+}
+
+// Колонки с целочисленными значениями
+var metaIntKeys = map[string]bool{"level": true, "position": true, "question_count": true, "unlock_accuracy": true}
+
+// Значения режима ответа → Exercise.answer_mode
+var answerModes = map[string]string{
+	"buttons":     "",
+	"кнопки":      "",
+	"words":       "words",
+	"слова":       "words",
+	"sentence":    "sentence",
+	"предложение": "sentence",
+}
+
+// Значения типа упражнения → Exercise.type
+var exerciseTypes = map[string]string{
+	"sentence":    "",
+	"предложение": "",
+	"order":       "order",
+	"порядок":     "order",
+	"match":       "match",
+	"пары":        "match",
+	"cloze":       "cloze",
+	"пропуски":    "cloze",
+	"choice":      "choice",
+	"выбор":       "choice",
+}
+
+// Колонки с перечислимыми значениями и их допустимые значения
+var metaEnums = map[string]map[string]string{
+	"answer_mode": answerModes,
+	"type":        exerciseTypes,
+}
+
+// значение перечислимой колонки метаданных
+func metaEnum(column string, value string) string {
+	normalized, ok := metaEnums[column][strings.ToLower(strings.TrimSpace(value))]
+	if !ok {
+		log.Fatalf("Метаданные %s: неизвестное значение %q", column, value)
+	}
+	return normalized
+}
+
+// тип упражнения из метаданных; пусто — сборка перевода
+func exerciseTypeOf(meta map[string]string) string {
+	if value, ok := meta["type"]; ok {
+		return metaEnum("type", value)
+	}
+	return ""
+}
+
+func isMetaSheet(name string) bool {
+	for _, metaName := range metaSheetNames {
+		if strings.EqualFold(strings.TrimSpace(name), metaName) {
+			return true
+		}
+	}
+	return false
+}
+
+// лист с вопросами: первый лист, который не является листом метаданных
+func exerciseSheet(f *excelize.File) string {
+	for _, name := range f.GetSheetList() {
+		if !isMetaSheet(name) {
+			return name
+		}
+	}
+	log.Fatal("в книге нет листа с вопросами")
+	return ""
+}
+
+// строка-заголовок вида "#уровень | 2" на листе с вопросами
+func isMetaRow(row []string) bool {
+	return strings.HasPrefix(strings.TrimSpace(row[0]), "#")
+}
+
+// прочитать метаданные с листа meta и из строк-заголовков листа с вопросами;
+// заголовки листа с вопросами имеют приоритет
+func readMeta(f *excelize.File, exerciseRows [][]string) map[string]string {
+	meta := make(map[string]string)
+	for _, name := range f.GetSheetList() {
+		if !isMetaSheet(name) {
+			continue
+		}
+		rows, err := f.GetRows(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, row := range rows {
+			addMeta(meta, row, "")
+		}
+	}
+	for _, row := range exerciseRows {
+		if len(row) > 0 && isMetaRow(row) {
+			addMeta(meta, row, "#")
+		}
+	}
+	return meta
+}
+
+func addMeta(meta map[string]string, row []string, prefix string) {
+	if len(row) < 2 {
+		return
+	}
+	key := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(row[0]), prefix)))
+	key = strings.TrimSuffix(key, ":")
+	column, ok := metaKeys[key]
+	if !ok {
+		if key != "" {
+			log.Printf("Неизвестный ключ метаданных %q пропущен", row[0])
+		}
+		return
+	}
+	meta[column] = strings.TrimSpace(row[1])
+}
+
+// записать метаданные в Exercise
+func applyMeta(db *sql.DB, title string, meta map[string]string) {
+	for column, value := range meta {
+		var arg interface{} = value
+		if metaIntKeys[column] {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				log.Fatalf("Метаданные %s: ожидается число, получено %q", column, value)
+			}
+			arg = n
+		}
+		if metaEnums[column] != nil {
+			arg = metaEnum(column, value)
+		}
+		res, err := db.Exec(`UPDATE Exercise SET `+column+` = ? WHERE title = ?`, arg, title)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			log.Fatalf("Упражнение %q не найдено. Сначала создайте его командой new", title)
+		}
+	}
+}
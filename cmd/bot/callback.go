@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Формат callback data (до base64url без паддинга):
+//
+//	version(1) | action(1) | nonce(uvarint) | count(1) | ids(uvarint...) | hmac(8)
+//
+// HMAC-SHA256 от всех предшествующих байт, усечённый до 8 байт.
+// Telegram ограничивает callback data 64 байтами.
+const (
+	callbackVersion   = 1
+	callbackMACSize   = 8
+	maxCallbackData   = 64
+	maxCallbackIDs    = 4
+	callbackSecretEnv = "CALLBACK_SECRET"
+)
+
+// CallbackAction — действие, которое кодирует кнопка
+type CallbackAction byte
+
+const (
+	ActionCombinatorics  CallbackAction = iota + 1 // раздел «Комбинаторика»
+	ActionListening                                // раздел «Аудирование»
+	ActionExercise                                 // карточка упражнения: IDs[0] = Exercise.id
+	ActionAnswer                                   // выбор варианта: IDs[0] = Option.id
+	ActionExerciseList                             // список упражнений: IDs = группа, страница
+	ActionStartExercise                            // запуск упражнения: IDs[0] = Exercise.id
+	ActionCourseList                               // список курсов
+	ActionCourse                                   // карточка курса: IDs[0] = Course.id
+	ActionTypedLetter                              // экранная буква в режиме ввода: IDs[0] = индекс буквы
+	ActionTypedBackspace                           // стереть последний набранный символ
+	ActionTypedSubmit                              // проверить набранный ответ
+	ActionStartReverse                             // запуск с татарского на русский: IDs[0] = Exercise.id
+	ActionStartOrder                               // запуск в режиме «порядок слов»: IDs[0] = Exercise.id
+	ActionOrderPick                                // часть предложения: IDs[0] = SubQuestion.id её начала
+	ActionAssignments                              // задания ученика
+)
+
+// сколько идентификаторов несёт каждое действие
+var callbackArity = map[CallbackAction]int{
+	ActionCombinatorics:  0,
+	ActionListening:      0,
+	ActionExercise:       1,
+	ActionAnswer:         1,
+	ActionExerciseList:   2,
+	ActionStartExercise:  1,
+	ActionCourseList:     0,
+	ActionCourse:         1,
+	ActionTypedLetter:    1,
+	ActionTypedBackspace: 0,
+	ActionTypedSubmit:    0,
+	ActionStartReverse:   1,
+	ActionStartOrder:     1,
+	ActionOrderPick:      1,
+	ActionAssignments:    0,
+}
+
+// Callback — разобранные данные inline-кнопки
+type Callback struct {
+	Action CallbackAction
+	Nonce  uint32 // nonce сессии упражнения; 0 — кнопка вне упражнения
+	IDs    []int64
+}
+
+var (
+	errCallbackMalformed = errors.New("повреждённые данные кнопки")
+	errCallbackForged    = errors.New("подпись кнопки не совпадает")
+	errCallbackOutdated  = errors.New("устаревшая версия кнопки")
+)
+
+// секрет для подписи кнопок
+var callbackSecret []byte
+
+// загрузить секрет из CALLBACK_SECRET; без него кнопки не переживут перезапуск
+func initCallbackSecret() {
+	if secret := os.Getenv(callbackSecretEnv); secret != "" {
+		callbackSecret = []byte(secret)
+		return
+	}
+	log.Printf("%s не задан: используется случайный секрет, старые кнопки перестанут работать после перезапуска", callbackSecretEnv)
+	callbackSecret = make([]byte, 32)
+	if _, err := rand.Read(callbackSecret); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func callbackMAC(payload []byte) []byte {
+	mac := hmac.New(sha256.New, callbackSecret)
+	mac.Write(payload)
+	return mac.Sum(nil)[:callbackMACSize]
+}
+
+// закодировать и подписать данные кнопки
+func encodeCallback(cb Callback) (string, error) {
+	if arity, ok := callbackArity[cb.Action]; !ok || arity != len(cb.IDs) {
+		return "", fmt.Errorf("действие %d с %d id: %w", cb.Action, len(cb.IDs), errCallbackMalformed)
+	}
+	payload := []byte{callbackVersion, byte(cb.Action)}
+	payload = binary.AppendUvarint(payload, uint64(cb.Nonce))
+	payload = append(payload, byte(len(cb.IDs)))
+	for _, id := range cb.IDs {
+		if id < 0 {
+			return "", fmt.Errorf("отрицательный id %d: %w", id, errCallbackMalformed)
+		}
+		payload = binary.AppendUvarint(payload, uint64(id))
+	}
+	payload = append(payload, callbackMAC(payload)...)
+
+	data := base64.RawURLEncoding.EncodeToString(payload)
+	if len(data) > maxCallbackData {
+		return "", fmt.Errorf("callback data %d байт > %d", len(data), maxCallbackData)
+	}
+	return data, nil
+}
+
+// проверить подпись и разобрать данные кнопки
+func decodeCallback(data string) (Callback, error) {
+	var cb Callback
+	raw, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil || len(raw) < 2+callbackMACSize {
+		return cb, errCallbackMalformed
+	}
+	payload, mac := raw[:len(raw)-callbackMACSize], raw[len(raw)-callbackMACSize:]
+	if !hmac.Equal(mac, callbackMAC(payload)) {
+		return cb, errCallbackForged
+	}
+	if payload[0] != callbackVersion {
+		return cb, errCallbackOutdated
+	}
+
+	cb.Action = CallbackAction(payload[1])
+	rest := payload[2:]
+	nonce, n := binary.Uvarint(rest)
+	if n <= 0 || nonce > 0xFFFFFFFF {
+		return cb, errCallbackMalformed
+	}
+	cb.Nonce = uint32(nonce)
+	rest = rest[n:]
+
+	if len(rest) < 1 {
+		return cb, errCallbackMalformed
+	}
+	count := int(rest[0])
+	rest = rest[1:]
+	if arity, ok := callbackArity[cb.Action]; !ok || arity != count || count > maxCallbackIDs {
+		return cb, errCallbackMalformed
+	}
+	for i := 0; i < count; i++ {
+		id, n := binary.Uvarint(rest)
+		if n <= 0 {
+			return cb, errCallbackMalformed
+		}
+		cb.IDs = append(cb.IDs, int64(id))
+		rest = rest[n:]
+	}
+	if len(rest) != 0 {
+		return cb, errCallbackMalformed
+	}
+	return cb, nil
+}
+
+// inline-кнопка с подписанными данными
+func callbackButton(text string, action CallbackAction, nonce uint32, ids ...int64) tgbotapi.InlineKeyboardButton {
+	data, err := encodeCallback(Callback{Action: action, Nonce: nonce, IDs: ids})
+	if err != nil {
+		log.Fatalf("Ошибка кодирования кнопки %q: %v", text, err)
+	}
+	return tgbotapi.NewInlineKeyboardButtonData(text, data)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestCallbackRoundTripFitsTelegramLimit(t *testing.T) {
+	cb := Callback{Action: ActionAnswer, Nonce: 0xFFFFFFFF, IDs: []int64{1<<53 - 1}}
+	data, err := encodeCallback(cb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > maxCallbackData {
+		t.Errorf("callback data %d байт", len(data))
+	}
+	got, err := decodeCallback(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Action != cb.Action || got.Nonce != cb.Nonce || got.IDs[0] != cb.IDs[0] {
+		t.Errorf("разобрано %+v, ожидалось %+v", got, cb)
+	}
+}
+
+func TestCallbackRejectsForgedAndOutdated(t *testing.T) {
+	data, err := encodeCallback(Callback{Action: ActionAnswer, Nonce: 7, IDs: []int64{400}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := base64.RawURLEncoding.DecodeString(data)
+
+	// подмена id варианта без пересчёта подписи
+	forged := append([]byte(nil), raw...)
+	forged[4]++
+	if _, err := decodeCallback(base64.RawURLEncoding.EncodeToString(forged)); !errors.Is(err, errCallbackForged) {
+		t.Errorf("поддельный id: %v", err)
+	}
+
+	// корректно подписанная кнопка другой версии протокола
+	old := append([]byte{callbackVersion + 1}, raw[1:len(raw)-callbackMACSize]...)
+	old = append(old, callbackMAC(old)...)
+	if _, err := decodeCallback(base64.RawURLEncoding.EncodeToString(old)); !errors.Is(err, errCallbackOutdated) {
+		t.Errorf("другая версия: %v", err)
+	}
+
+	for _, legacy := range []string{"ansID=400;", "ExerciseID=1;", "Combinatorics", ""} {
+		if _, err := decodeCallback(legacy); err == nil {
+			t.Errorf("принята кнопка старого формата %q", legacy)
+		}
+	}
+}
+
+func TestOutdatedSessionButtonIsIgnored(t *testing.T) {
+	c := newTestChat(t)
+	first := c.openExercise("level2")
+
+	// повторный запуск упражнения делает старые кнопки недействительными
+	card := c.m.messages[c.m.sent[0].MessageID]
+	c.press(card, "▶ Начать")
+	second := c.m.lastSent(t)
+	before := first.Text
+	c.press(first, "Мин")
+	if first.Text != before {
+		t.Errorf("старая кнопка изменила сообщение: %q", first.Text)
+	}
+
+	c.press(second, "Мин")
+	if second.Text == before {
+		t.Error("кнопка текущей сессии не сработала")
+	}
+}
+
+func TestOptionFromAnotherExerciseIsRejected(t *testing.T) {
+	c := newTestChat(t)
+	msg := c.openExercise("level2")
+	before := msg.Text
+
+	// правильно подписанная кнопка с вариантом из level1 (SubQuestion 100)
+	db := openDB()
+	defer db.Close()
+	var nonce uint32
+	var optionID int64
+	if err := db.QueryRow(`SELECT nonce FROM ExerciseSession WHERE user_id = ?`, c.chatID).Scan(&nonce); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(`SELECT id FROM Option WHERE sub_question_id = 100 AND text = 'Сез'`).Scan(&optionID); err != nil {
+		t.Fatal(err)
+	}
+	markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		callbackButton("Сез", ActionAnswer, nonce, optionID),
+	))
+	msg.Markup = &markup
+	c.press(msg, "Сез")
+	if msg.Text != before {
+		t.Errorf("принят вариант из чужого упражнения: %q", msg.Text)
+	}
+}
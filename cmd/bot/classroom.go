@@ -0,0 +1,486 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Класс — группа учеников учителя. Учитель создаёт класс (/class new),
+// ученики вступают по коду (/join или ссылка t.me/<бот>?start=class_<код>).
+// Задание — упражнение или курс со сроком; выполненным считается упражнение,
+// пройденное после выдачи задания. Задания ученика — в главном меню (/start),
+// прогресс класса учитель смотрит командой /class progress. Назначенные
+// упражнения открыты ученику независимо от уровня.
+
+// префикс параметра /start в ссылке на класс
+const classStartPrefix = "class_"
+
+// формат срока задания
+const deadlineLayout = "02.01.2006"
+
+// classroom — класс учителя
+type classroom struct {
+	ID        int64
+	Title     string
+	TeacherID int64
+	Code      string
+}
+
+// assignment — задание класса с упражнениями, которые в него входят
+type assignment struct {
+	ID         int64
+	Classroom  string
+	ExerciseID int64 // задано упражнение; 0 — курс
+	CourseID   int64
+	Title      string
+	Deadline   int64 // unix-время конца дня срока; 0 — без срока
+	CreatedAt  int64
+	Exercises  []int64
+}
+
+// assignmentProgress — выполнение задания учеником
+type assignmentProgress struct {
+	Done, Total    int
+	Answers, Right int // ответы в упражнениях задания после его выдачи
+}
+
+// метка состояния задания
+func (p assignmentProgress) mark(a assignment, now time.Time) string {
+	switch {
+	case p.Total > 0 && p.Done == p.Total:
+		return "✅"
+	case a.Deadline > 0 && now.Unix() > a.Deadline:
+		return "⚠️"
+	default:
+		return "⏳"
+	}
+}
+
+// название задания со сроком
+func (a assignment) label() string {
+	label := a.Title
+	if a.CourseID != 0 {
+		label = "📚 " + label
+	}
+	if a.Deadline > 0 {
+		label += " — до " + time.Unix(a.Deadline, 0).Format(deadlineLayout)
+	}
+	return label
+}
+
+// Обработчик команды /class: классы учителя и управление ими
+func handleClassCommand(m Messenger, msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		sendMessage(m, msg.Chat.ID, teacherClassroomsText(msg.From.ID))
+		return
+	}
+	switch strings.ToLower(args[0]) {
+	case "new":
+		title := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(msg.CommandArguments()), args[0]))
+		if title == "" {
+			sendMessage(m, msg.Chat.ID, classUsage)
+			return
+		}
+		createClassroom(m, msg.Chat.ID, msg.From.ID, title)
+	case "assign":
+		if len(args) != 4 && len(args) != 5 {
+			sendMessage(m, msg.Chat.ID, classUsage)
+			return
+		}
+		sendMessage(m, msg.Chat.ID, assignToClassroom(msg.From.ID, args[1:]))
+	case "progress":
+		if len(args) != 2 {
+			sendMessage(m, msg.Chat.ID, classUsage)
+			return
+		}
+		sendLongMessage(m, msg.Chat.ID, classroomProgressText(msg.From.ID, args[1], time.Now()))
+	default:
+		sendMessage(m, msg.Chat.ID, classUsage)
+	}
+}
+
+const classUsage = "Формат:\n/class — ваши классы\n/class new <название> — создать класс\n" +
+	"/class assign <id класса> <exercise|course> <id> [ДД.ММ.ГГГГ] — выдать задание\n/class progress <id класса> — прогресс учеников"
+
+// классы учителя с кодами
+func teacherClassroomsText(teacherID int64) string {
+	db := openDB()
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT c.id, c.title, c.code,
+			(SELECT COUNT(*) FROM ClassroomMember m WHERE m.classroom_id = c.id),
+			(SELECT COUNT(*) FROM Assignment a WHERE a.classroom_id = c.id)
+		FROM Classroom c
+		WHERE c.teacher_id = ?
+		ORDER BY c.id`, teacherID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+
+	var text strings.Builder
+	for rows.Next() {
+		var id int64
+		var title, code string
+		var members, assignments int
+		if err := rows.Scan(&id, &title, &code, &members, &assignments); err != nil {
+			log.Fatal(err)
+		}
+		if text.Len() == 0 {
+			text.WriteString("Ваши классы:")
+		}
+		fmt.Fprintf(&text, "\n#%d %s — учеников: %d, заданий: %d, код %s", id, title, members, assignments, code)
+	}
+	if text.Len() == 0 {
+		text.WriteString("У вас пока нет классов")
+	}
+	return text.String() + "\n\n" + classUsage
+}
+
+// создать класс и показать код для учеников
+func createClassroom(m Messenger, chatID int64, teacherID int64, title string) {
+	db := openDB()
+	defer db.Close()
+
+	code := newInviteCode()
+	res, err := db.Exec(`INSERT INTO Classroom (title, teacher_id, code, created_at) VALUES (?, ?, ?, ?)`,
+		title, teacherID, code, time.Now().Unix())
+	if err != nil {
+		log.Fatal(err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Fatal(err)
+	}
+	text := fmt.Sprintf("Класс «%s» создан (#%d). Ученики вступают командой /join %s", title, id, code)
+	if botUserName != "" {
+		text += fmt.Sprintf("\nили по ссылке https://t.me/%s?start=%s%s", botUserName, classStartPrefix, code)
+	}
+	sendMessage(m, chatID, text)
+}
+
+// класс, которым управляет пользователь; текст — почему нельзя
+func managedClassroom(db *sql.DB, userID int64, arg string) (*classroom, string) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(arg, "#"), 10, 64)
+	if err != nil {
+		return nil, "Некорректный id класса"
+	}
+	c := &classroom{ID: id}
+	err = db.QueryRow(`SELECT title, teacher_id, code FROM Classroom WHERE id = ?`, id).Scan(&c.Title, &c.TeacherID, &c.Code)
+	if err == sql.ErrNoRows {
+		return nil, "Класс не найден"
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if c.TeacherID != userID && userRole(userID) < RoleAdmin {
+		return nil, "Это не ваш класс"
+	}
+	return c, ""
+}
+
+// выдать задание: args = id класса, exercise|course, id, [срок]
+func assignToClassroom(teacherID int64, args []string) string {
+	db := openDB()
+	defer db.Close()
+
+	c, reason := managedClassroom(db, teacherID, args[0])
+	if c == nil {
+		return reason
+	}
+	targetID, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return "Некорректный id упражнения или курса"
+	}
+	var exerciseID, courseID int64
+	var title string
+	switch strings.ToLower(args[1]) {
+	case "exercise", "упражнение":
+		exerciseID = targetID
+		err = db.QueryRow(`SELECT title FROM Exercise WHERE id = ?`, targetID).Scan(&title)
+	case "course", "курс":
+		courseID = targetID
+		err = db.QueryRow(`SELECT title FROM Course WHERE id = ?`, targetID).Scan(&title)
+	default:
+		return classUsage
+	}
+	if err == sql.ErrNoRows {
+		return "Упражнение или курс не найден"
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	var deadline int64
+	if len(args) == 4 {
+		day, err := time.ParseInLocation(deadlineLayout, args[3], time.Local)
+		if err != nil {
+			return "Срок — дата в формате ДД.ММ.ГГГГ"
+		}
+		deadline = day.AddDate(0, 0, 1).Unix() - 1 // до конца дня
+	}
+
+	_, err = db.Exec(`INSERT INTO Assignment (classroom_id, exercise_id, course_id, deadline, created_at) VALUES (?, ?, ?, ?, ?)`,
+		c.ID, exerciseID, courseID, deadline, time.Now().Unix())
+	if err != nil {
+		log.Fatal(err)
+	}
+	a := assignment{CourseID: courseID, Title: title, Deadline: deadline}
+	return fmt.Sprintf("Классу «%s» задано: %s", c.Title, a.label())
+}
+
+// Обработчик команды /join <код>
+func handleJoinCommand(m Messenger, msg *tgbotapi.Message) {
+	code := strings.TrimSpace(msg.CommandArguments())
+	if code == "" {
+		sendMessage(m, msg.Chat.ID, "Формат: /join <код класса>. Код выдаёт учитель")
+		return
+	}
+	sendMessage(m, msg.Chat.ID, joinClassroom(msg.From.ID, code))
+}
+
+// вступить в класс по коду
+func joinClassroom(userID int64, code string) string {
+	db := openDB()
+	defer db.Close()
+
+	var c classroom
+	err := db.QueryRow(`SELECT id, title, teacher_id FROM Classroom WHERE code = ?`, code).Scan(&c.ID, &c.Title, &c.TeacherID)
+	if err == sql.ErrNoRows {
+		return "Класс с таким кодом не найден"
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	res, err := db.Exec(`INSERT OR IGNORE INTO ClassroomMember (classroom_id, user_id, joined_at) VALUES (?, ?, ?)`,
+		c.ID, userID, time.Now().Unix())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Sprintf("Вы уже в классе «%s»", c.Title)
+	}
+	return fmt.Sprintf("Вы в классе «%s» (учитель %s). Задания — в меню /start", c.Title, userName(db, c.TeacherID))
+}
+
+// задания по условию where с упражнениями, которые в них входят
+func loadAssignments(db *sql.DB, where string, args ...interface{}) []assignment {
+	rows, err := db.Query(`SELECT a.id, c.title, a.exercise_id, a.course_id,
+			COALESCE(e.title, co.title, ''), a.deadline, a.created_at
+		FROM Assignment a
+		JOIN Classroom c ON c.id = a.classroom_id
+		LEFT JOIN Exercise e ON e.id = a.exercise_id
+		LEFT JOIN Course co ON co.id = a.course_id
+		WHERE `+where+`
+		ORDER BY a.deadline = 0, a.deadline, a.id`, args...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var list []assignment
+	for rows.Next() {
+		var a assignment
+		if err := rows.Scan(&a.ID, &a.Classroom, &a.ExerciseID, &a.CourseID, &a.Title, &a.Deadline, &a.CreatedAt); err != nil {
+			log.Fatal(err)
+		}
+		list = append(list, a)
+	}
+	rows.Close()
+	for i := range list {
+		list[i].Exercises = assignmentExercises(db, list[i])
+	}
+	return list
+}
+
+// упражнения задания: одно упражнение или все упражнения курса по порядку
+func assignmentExercises(db *sql.DB, a assignment) []int64 {
+	if a.ExerciseID != 0 {
+		return []int64{a.ExerciseID}
+	}
+	rows, err := db.Query(`SELECT ce.exercise_id
+		FROM CourseUnit u
+		JOIN CourseExercise ce ON ce.unit_id = u.id
+		WHERE u.course_id = ?
+		ORDER BY u.position, u.id, ce.position, ce.exercise_id`, a.CourseID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			log.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// задания ученика во всех его классах
+func studentAssignments(db *sql.DB, userID int64) []assignment {
+	return loadAssignments(db, `a.classroom_id IN (SELECT classroom_id FROM ClassroomMember WHERE user_id = ?)`, userID)
+}
+
+// выполнение задания учеником по ExerciseResult и AnswerEvent после выдачи задания
+func loadAssignmentProgress(db *sql.DB, a assignment, userID int64) assignmentProgress {
+	p := assignmentProgress{Total: len(a.Exercises)}
+	for _, exerciseID := range a.Exercises {
+		var done bool
+		var answers, right int
+		err := db.QueryRow(`SELECT
+				EXISTS (SELECT 1 FROM ExerciseResult WHERE user_id = ? AND exercise_id = ? AND finished_at >= ?),
+				(SELECT COUNT(*) FROM AnswerEvent WHERE user_id = ? AND exercise_id = ? AND nonce != 0 AND created_at >= ?),
+				(SELECT COUNT(*) FROM AnswerEvent WHERE user_id = ? AND exercise_id = ? AND nonce != 0 AND created_at >= ? AND is_right = 1)`,
+			userID, exerciseID, a.CreatedAt,
+			userID, exerciseID, a.CreatedAt,
+			userID, exerciseID, a.CreatedAt).Scan(&done, &answers, &right)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if done {
+			p.Done++
+		}
+		p.Answers += answers
+		p.Right += right
+	}
+	return p
+}
+
+// число невыполненных заданий ученика; -1 — заданий нет
+func pendingAssignments(userID int64) int {
+	db := openDB()
+	defer db.Close()
+
+	list := studentAssignments(db, userID)
+	if len(list) == 0 {
+		return -1
+	}
+	pending := 0
+	for _, a := range list {
+		if p := loadAssignmentProgress(db, a, userID); p.Done < p.Total {
+			pending++
+		}
+	}
+	return pending
+}
+
+// условие SQL «упражнение exercise задано ученику через класс»: упражнением или
+// курсом, в который оно входит. Параметр — id ученика; если exercise — «?»,
+// за ним ещё два параметра с id упражнения. Общее для exerciseAssigned
+// и lockedExercises, чтобы правило было одно
+func assignedExerciseSQL(exercise string) string {
+	return `EXISTS (
+			SELECT 1
+			FROM Assignment a
+			JOIN ClassroomMember m ON m.classroom_id = a.classroom_id
+			WHERE m.user_id = ?
+			  AND (a.exercise_id = ` + exercise + ` OR a.course_id IN (
+				SELECT u.course_id FROM CourseUnit u JOIN CourseExercise ce ON ce.unit_id = u.id WHERE ce.exercise_id = ` + exercise + `))
+		)`
+}
+
+// упражнение входит в задание одного из классов ученика
+func exerciseAssigned(db *sql.DB, userID int64, exerciseID int64) bool {
+	var assigned bool
+	err := db.QueryRow(`SELECT `+assignedExerciseSQL("?"), userID, exerciseID, exerciseID).Scan(&assigned)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return assigned
+}
+
+// показать задания ученика со сроками и кнопками упражнений и курсов
+func AssignmentList(m Messenger, chatID int64, messageID int, userID int64) {
+	db := openDB()
+	list := studentAssignments(db, userID)
+	now := time.Now()
+	var text strings.Builder
+	text.WriteString("📝 Задания")
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	for _, a := range list {
+		p := loadAssignmentProgress(db, a, userID)
+		line := p.mark(a, now) + " " + a.label()
+		if p.Total > 1 {
+			line += fmt.Sprintf(" (%d/%d)", p.Done, p.Total)
+		}
+		fmt.Fprintf(&text, "\n%s · %s", line, a.Classroom)
+		if a.CourseID != 0 {
+			keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(callbackButton(line, ActionCourse, 0, a.CourseID)))
+		} else {
+			keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(callbackButton(line, ActionExercise, 0, a.ExerciseID)))
+		}
+	}
+	db.Close()
+	if len(list) == 0 {
+		text.WriteString("\nЗаданий пока нет")
+	}
+	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(callbackButton("⬅️ К упражнениям", ActionExerciseList, 0, 0, 0)))
+	showScreen(m, chatID, messageID, text.String(), keyboard)
+}
+
+// прогресс учеников класса по заданиям
+func classroomProgressText(teacherID int64, arg string, now time.Time) string {
+	db := openDB()
+	defer db.Close()
+
+	c, reason := managedClassroom(db, teacherID, arg)
+	if c == nil {
+		return reason
+	}
+	list := loadAssignments(db, `a.classroom_id = ?`, c.ID)
+
+	rows, err := db.Query(`SELECT user_id FROM ClassroomMember WHERE classroom_id = ? ORDER BY joined_at, user_id`, c.ID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var members []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			log.Fatal(err)
+		}
+		members = append(members, id)
+	}
+	rows.Close()
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "📊 Класс «%s», учеников: %d", c.Title, len(members))
+	if len(list) == 0 {
+		text.WriteString("\nЗаданий пока нет")
+	}
+	for i, a := range list {
+		fmt.Fprintf(&text, "\n%d. %s", i+1, a.label())
+	}
+	for _, userID := range members {
+		done, answers, right := 0, 0, 0
+		var marks []string
+		for i, a := range list {
+			p := loadAssignmentProgress(db, a, userID)
+			if p.Total > 0 && p.Done == p.Total {
+				done++
+			}
+			answers += p.Answers
+			right += p.Right
+			mark := fmt.Sprintf("%d %s", i+1, p.mark(a, now))
+			if p.Total > 1 {
+				mark += fmt.Sprintf(" %d/%d", p.Done, p.Total)
+			}
+			marks = append(marks, mark)
+		}
+		accuracy := "—"
+		if answers > 0 {
+			accuracy = fmt.Sprintf("%d%% (ответов: %d)", right*100/answers, answers)
+		}
+		fmt.Fprintf(&text, "\n\n%s — выполнено %d/%d, точность %s", userName(db, userID), done, len(list), accuracy)
+		if len(marks) > 0 {
+			text.WriteString("\n  " + strings.Join(marks, " · "))
+		}
+	}
+	return text.String()
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAssignmentMark(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local)
+	tomorrow := now.AddDate(0, 0, 1).Unix()
+	yesterday := now.AddDate(0, 0, -1).Unix()
+	tests := []struct {
+		deadline    int64
+		done, total int
+		want        string
+	}{
+		{0, 0, 1, "⏳"},
+		{tomorrow, 0, 1, "⏳"},
+		{yesterday, 0, 1, "⚠️"},
+		{yesterday, 1, 2, "⚠️"},
+		{yesterday, 2, 2, "✅"}, // выполнено позже срока — всё равно выполнено
+		{tomorrow, 0, 0, "⏳"},  // пустой курс не считается выполненным
+	}
+	for _, tt := range tests {
+		a := assignment{Deadline: tt.deadline}
+		p := assignmentProgress{Done: tt.done, Total: tt.total}
+		if got := p.mark(a, now); got != tt.want {
+			t.Errorf("mark(срок %d, %d/%d) = %s, ожидалось %s", tt.deadline, tt.done, tt.total, got, tt.want)
+		}
+	}
+}
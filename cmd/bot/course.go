@@ -0,0 +1,279 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Курс — цепочка упражнений: Course → CourseUnit → CourseExercise.
+// После завершения упражнения из текущего курса ученику предлагается
+// следующее непройденное упражнение (или оно запускается сразу, если у курса
+// включён auto_advance).
+
+// courseExercise — упражнение курса в порядке прохождения
+type courseExercise struct {
+	ExerciseID int64
+	Title      string
+	UnitTitle  string
+	Done       bool
+}
+
+// courseInfo — курс с прогрессом ученика
+type courseInfo struct {
+	ID          int64
+	Title       string
+	Description string
+	AutoAdvance bool
+	Exercises   []courseExercise
+}
+
+// число пройденных упражнений курса
+func (c *courseInfo) doneCount() int {
+	done := 0
+	for _, ex := range c.Exercises {
+		if ex.Done {
+			done++
+		}
+	}
+	return done
+}
+
+// следующее непройденное упражнение; nil — курс пройден
+func (c *courseInfo) next() *courseExercise {
+	for i := range c.Exercises {
+		if !c.Exercises[i].Done {
+			return &c.Exercises[i]
+		}
+	}
+	return nil
+}
+
+// загрузить курс с прогрессом ученика; nil — курса нет
+func loadCourse(userID int64, courseID int64) *courseInfo {
+	db := openDB()
+	defer db.Close()
+
+	course := &courseInfo{ID: courseID}
+	err := db.QueryRow(`SELECT title, description, auto_advance FROM Course WHERE id = ?`, courseID).
+		Scan(&course.Title, &course.Description, &course.AutoAdvance)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rows, err := db.Query(`SELECT
+			e.id,
+			e.title,
+			u.title,
+			EXISTS (SELECT 1 FROM ExerciseResult r WHERE r.user_id = ? AND r.exercise_id = e.id) AS done
+		FROM CourseUnit u
+		JOIN CourseExercise ce ON ce.unit_id = u.id
+		JOIN Exercise e ON e.id = ce.exercise_id
+		WHERE u.course_id = ?
+		ORDER BY u.position, u.id, ce.position, e.id`, userID, courseID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ex courseExercise
+		if err := rows.Scan(&ex.ExerciseID, &ex.Title, &ex.UnitTitle, &ex.Done); err != nil {
+			log.Fatal(err)
+		}
+		course.Exercises = append(course.Exercises, ex)
+	}
+	return course
+}
+
+// все курсы в порядке создания
+func loadCourseIDs() []int64 {
+	db := openDB()
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id FROM Course ORDER BY position, id`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			log.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// текущий курс ученика; 0 — не выбран
+func currentCourseID(userID int64) int64 {
+	db := openDB()
+	defer db.Close()
+
+	var courseID int64
+	err := db.QueryRow(`SELECT course_id FROM UserCourse WHERE user_id = ?`, userID).Scan(&courseID)
+	if err == sql.ErrNoRows {
+		return 0
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return courseID
+}
+
+// сделать курс текущим для ученика
+func setCurrentCourse(userID int64, courseID int64) {
+	db := openDB()
+	defer db.Close()
+
+	_, err := db.Exec(`INSERT INTO UserCourse (user_id, course_id, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET course_id = excluded.course_id, updated_at = excluded.updated_at`,
+		userID, courseID, time.Now().Unix())
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// текущий курс ученика, если в нём есть упражнение exerciseID
+func currentCourseWith(userID int64, exerciseID int64) *courseInfo {
+	courseID := currentCourseID(userID)
+	if courseID == 0 {
+		return nil
+	}
+	course := loadCourse(userID, courseID)
+	if course == nil {
+		return nil
+	}
+	for _, ex := range course.Exercises {
+		if ex.ExerciseID == exerciseID {
+			return course
+		}
+	}
+	return nil
+}
+
+// показать список курсов, редактируя messageID (0 — отправить новое сообщение)
+func CourseList(m Messenger, chatID int64, messageID int, userID int64) {
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	for _, id := range loadCourseIDs() {
+		course := loadCourse(userID, id)
+		label := fmt.Sprintf("%s (%d/%d ✅)", course.Title, course.doneCount(), len(course.Exercises))
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(callbackButton(label, ActionCourse, 0, id)))
+	}
+	text := "Выберите курс"
+	if len(keyboard) == 0 {
+		text = "Курсов пока нет"
+	}
+	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(callbackButton("⬅️ К упражнениям", ActionExerciseList, 0, 0, 0)))
+	showScreen(m, chatID, messageID, text, keyboard)
+}
+
+// показать курс с прогрессом по юнитам и кнопкой продолжения
+func CourseCard(m Messenger, chatID int64, messageID int, userID int64, courseID int64) {
+	course := loadCourse(userID, courseID)
+	if course == nil {
+		CourseList(m, chatID, messageID, userID)
+		return
+	}
+	setCurrentCourse(userID, courseID)
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("📚 %s\nПрогресс: %d/%d", course.Title, course.doneCount(), len(course.Exercises)))
+	if course.Description != "" {
+		text.WriteString("\n\n" + course.Description)
+	}
+	text.WriteString("\n")
+	for i := 0; i < len(course.Exercises); {
+		unit := course.Exercises[i].UnitTitle
+		done, total := 0, 0
+		for ; i < len(course.Exercises) && course.Exercises[i].UnitTitle == unit; i++ {
+			total++
+			if course.Exercises[i].Done {
+				done++
+			}
+		}
+		mark := ""
+		if done == total {
+			mark = " ✅"
+		}
+		text.WriteString(fmt.Sprintf("\n%s — %d/%d%s", unit, done, total, mark))
+	}
+
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	if next := course.next(); next != nil {
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			callbackButton("▶ Продолжить: "+next.Title, ActionExercise, 0, next.ExerciseID),
+		))
+	} else {
+		text.WriteString("\n\nКурс пройден 🎉")
+	}
+	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(callbackButton("⬅️ К курсам", ActionCourseList, 0)))
+	showScreen(m, chatID, messageID, text.String(), keyboard)
+}
+
+// после завершения упражнения: продолжить курс или показать список упражнений
+func afterExerciseFinished(m Messenger, msg *tgbotapi.Message, userID int64, exerciseID int64) {
+	if duelPlayerFinished(m, msg, userID) {
+		return
+	}
+	const header = "Упражнение закончено ✅"
+	course := currentCourseWith(userID, exerciseID)
+	if course == nil {
+		LevelsList(m, msg.Chat.ID, msg.MessageID, userID, 0, 0, header)
+		return
+	}
+
+	progress := fmt.Sprintf("%s\n\n📚 %s: %d/%d", header, course.Title, course.doneCount(), len(course.Exercises))
+	next := course.next()
+	switch {
+	case next == nil:
+		keyboard := [][]tgbotapi.InlineKeyboardButton{
+			tgbotapi.NewInlineKeyboardRow(callbackButton("⬅️ К курсам", ActionCourseList, 0)),
+		}
+		showScreen(m, msg.Chat.ID, msg.MessageID, progress+"\nКурс пройден 🎉", keyboard)
+	case course.AutoAdvance && exerciseLockReason(userID, next.ExerciseID) == "":
+		showScreen(m, msg.Chat.ID, msg.MessageID, progress+"\nДальше: "+next.Title, nil)
+		InitQuestionField(m, msg, userID, next.ExerciseID)
+	default:
+		keyboard := [][]tgbotapi.InlineKeyboardButton{
+			tgbotapi.NewInlineKeyboardRow(callbackButton("▶ Дальше: "+next.Title, ActionExercise, 0, next.ExerciseID)),
+			tgbotapi.NewInlineKeyboardRow(callbackButton("⬅️ К упражнениям", ActionExerciseList, 0, 0, 0)),
+		}
+		showScreen(m, msg.Chat.ID, msg.MessageID, progress, keyboard)
+	}
+}
+
+// Обработчик команды /continue
+func handleContinueCommand(m Messenger, msg *tgbotapi.Message) {
+	userID := msg.From.ID
+	courseID := currentCourseID(userID)
+	if courseID == 0 {
+		CourseList(m, msg.Chat.ID, 0, userID)
+		return
+	}
+	course := loadCourse(userID, courseID)
+	if course == nil {
+		CourseList(m, msg.Chat.ID, 0, userID)
+		return
+	}
+	next := course.next()
+	if next == nil {
+		CourseCard(m, msg.Chat.ID, 0, userID, courseID)
+		return
+	}
+	if reason := exerciseLockReason(userID, next.ExerciseID); reason != "" {
+		sendMessage(m, msg.Chat.ID, reason)
+		return
+	}
+	InitQuestionField(m, msg, userID, next.ExerciseID)
+}
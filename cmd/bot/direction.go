@@ -0,0 +1,55 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+)
+
+// Направление перевода. Обычно ученик собирает татарский перевод русского
+// предложения (SubQuestion.direction = 'tt'). Если у вопроса есть подвопросы
+// с direction = 'ru', упражнение можно пройти и обратно: бот показывает
+// собранное татарское предложение, а ученик собирает русский перевод.
+const (
+	DirectionForward = "tt"
+	DirectionReverse = "ru"
+)
+
+// собранное татарское предложение вопроса (кириллицей)
+func tatarSentence(db *sql.DB, questionID int64) string {
+	return renderAnswerField(loadSubQuestions(db, questionID, DirectionForward))
+}
+
+// можно ли пройти упражнение в обратном направлении
+func exerciseHasReverse(exerciseID int64) bool {
+	db := openDB()
+	defer db.Close()
+
+	var ok bool
+	err := db.QueryRow(`SELECT EXISTS (
+			SELECT 1
+			FROM Question q
+			JOIN SubQuestion sq ON sq.question_id = q.id
+			WHERE q.exercise_id = ? AND sq.direction = ? AND sq.pointing = 0
+		)`, exerciseID, DirectionReverse).Scan(&ok)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return ok
+}
+
+// письменность подписей вариантов: русские варианты не транслитерируются
+func (item Item) optionScript() Script {
+	return answerScript(item.Script, item.Direction)
+}
+
+// scriptRussian — «письменность» русского ответа в обратном направлении:
+// текст не транслитерируется, татарских экранных букв нет
+const scriptRussian Script = "ru"
+
+// письменность, в которой ученик отвечает
+func answerScript(script Script, direction string) Script {
+	if direction == DirectionReverse {
+		return scriptRussian
+	}
+	return script
+}
@@ -0,0 +1,624 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Дуэль: два ученика проходят одно упражнение с одинаковым набором случайных
+// вопросов. Соперник приходит по ссылке-приглашению или из очереди — это
+// первый, кто ждёт дуэль в том же упражнении. Каждый играет в обычной попытке
+// (ExerciseSession) со своим nonce, план вопросов общий (DuelQuestion).
+// Итог считается по AnswerEvent попыток: меньше ошибок — победа, при равенстве
+// побеждает тот, кто раньше ответил на последний вопрос. Всё состояние дуэли
+// хранится в базе, поэтому переживает перезапуск бота. Пока дуэль ждёт
+// соперника или идёт, другие попытки начинать нельзя: попытка у ученика одна,
+// и дуэль заменила бы её (или она — попытку дуэли). Дуэль без соперника
+// дольше duelWaitTimeout отменяется, идущая без ответов дольше duelIdleTimeout
+// завершается по таймауту; их раз в timeoutCheckInterval проверяет главный цикл.
+
+// Состояния дуэли (Duel.status)
+const (
+	DuelWaiting   = "waiting"   // ждём соперника
+	DuelActive    = "active"    // оба отвечают
+	DuelFinished  = "finished"  // итоги объявлены
+	DuelCancelled = "cancelled" // отменена до начала
+)
+
+// вопросов в дуэли, если в упражнении не задан question_count
+const duelQuestions = 5
+
+// сколько идущая дуэль может обходиться без ответов, прежде чем итоги подводятся по таймауту
+const duelIdleTimeout = 15 * time.Minute
+
+// сколько дуэль ждёт соперника, прежде чем отменяется
+const duelWaitTimeout = 30 * time.Minute
+
+// префикс параметра /start в ссылке-приглашении
+const duelStartPrefix = "duel_"
+
+// имя бота для ссылок-приглашений; пусто — приглашение командой
+var botUserName string
+
+// Обработчик команды /duel <id упражнения> | join <код> | cancel
+func handleDuelCommand(m Messenger, msg *tgbotapi.Message) {
+	if !msg.Chat.IsPrivate() {
+		sendMessage(m, msg.Chat.ID, "Дуэль проводится в личном чате с ботом")
+		return
+	}
+	userID := msg.From.ID
+	args := strings.Fields(msg.CommandArguments())
+	switch {
+	case len(args) == 1 && (strings.EqualFold(args[0], "cancel") || args[0] == "отмена"):
+		leaveDuel(m, msg.Chat.ID, userID)
+	case len(args) == 2 && strings.EqualFold(args[0], "join"):
+		joinDuelByCode(m, msg.Chat.ID, userID, args[1])
+	case len(args) == 1:
+		exerciseID, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			sendMessage(m, msg.Chat.ID, duelUsage)
+			return
+		}
+		enterDuelQueue(m, msg.Chat.ID, userID, exerciseID)
+	default:
+		sendMessage(m, msg.Chat.ID, duelUsage)
+	}
+}
+
+const duelUsage = "Формат: /duel <id упражнения> — найти соперника, /duel join <код> — принять приглашение, /duel cancel — выйти"
+
+// дуэль ученика, которая ждёт соперника или идёт; 0 — нет
+func currentDuel(db *sql.DB, userID int64) (int64, string) {
+	var duelID int64
+	var status string
+	err := db.QueryRow(`SELECT d.id, d.status
+		FROM Duel d
+		JOIN DuelPlayer p ON p.duel_id = d.id
+		WHERE p.user_id = ? AND d.status IN (?, ?)
+		ORDER BY d.id DESC LIMIT 1`, userID, DuelWaiting, DuelActive).Scan(&duelID, &status)
+	if err == sql.ErrNoRows {
+		return 0, ""
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return duelID, status
+}
+
+// дуэль, из-за которой ученику нельзя начинать другие попытки: ждущая
+// соперника (DuelWaiting) или идущая, где он ещё отвечает (DuelActive); пусто — нет
+func duelInProgress(userID int64) string {
+	db := openDB()
+	defer db.Close()
+
+	var status string
+	err := db.QueryRow(`SELECT d.status
+		FROM DuelPlayer p
+		JOIN Duel d ON d.id = p.duel_id
+		WHERE p.user_id = ?
+		  AND (d.status = ? OR d.status = ? AND p.finished_at IS NULL)
+		ORDER BY d.id DESC LIMIT 1`, userID, DuelWaiting, DuelActive).Scan(&status)
+	if err == sql.ErrNoRows {
+		return ""
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return status
+}
+
+// время, раньше которого созданная ждущая дуэль уже не принимает соперника
+func duelWaitCutoff() int64 {
+	return time.Now().Add(-duelWaitTimeout).Unix()
+}
+
+// отменить дуэли, не дождавшиеся соперника, и подвести итоги идущих,
+// в которых давно никто не отвечает
+func expireStaleDuels(m Messenger) {
+	cancelAbandonedDuels(m)
+
+	db := openDB()
+	rows, err := db.Query(`SELECT d.id
+		FROM Duel d
+		WHERE d.status = ?
+		  AND MAX(d.started_at, COALESCE((
+			SELECT MAX(a.created_at)
+			FROM DuelPlayer p
+			JOIN AnswerEvent a ON a.user_id = p.user_id AND a.nonce = p.nonce
+			WHERE p.duel_id = d.id
+		  ), 0)) < ?`, DuelActive, time.Now().Add(-duelIdleTimeout).Unix())
+	if err != nil {
+		log.Fatal(err)
+	}
+	var stale []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			log.Fatal(err)
+		}
+		stale = append(stale, id)
+	}
+	rows.Close()
+	db.Close()
+
+	for _, duelID := range stale {
+		finishDuel(m, duelID, 0)
+	}
+}
+
+// отменить ждущие дуэли старше duelWaitTimeout и сообщить создателям
+func cancelAbandonedDuels(m Messenger) {
+	db := openDB()
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT d.id, d.exercise_id, p.chat_id
+		FROM Duel d
+		JOIN DuelPlayer p ON p.duel_id = d.id
+		WHERE d.status = ? AND d.created_at < ?`, DuelWaiting, duelWaitCutoff())
+	if err != nil {
+		log.Fatal(err)
+	}
+	type abandoned struct {
+		duelID, exerciseID, chatID int64
+	}
+	var duels []abandoned
+	for rows.Next() {
+		var d abandoned
+		if err := rows.Scan(&d.duelID, &d.exerciseID, &d.chatID); err != nil {
+			log.Fatal(err)
+		}
+		duels = append(duels, d)
+	}
+	rows.Close()
+
+	for _, d := range duels {
+		res, err := db.Exec(`UPDATE Duel SET status = ?, finished_at = ? WHERE id = ? AND status = ?`,
+			DuelCancelled, time.Now().Unix(), d.duelID, DuelWaiting)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		sendMessage(m, d.chatID, fmt.Sprintf("⌛ Соперник не нашёлся за %d мин — дуэль отменена. Попробовать ещё раз: /duel %d",
+			int(duelWaitTimeout/time.Minute), d.exerciseID))
+	}
+}
+
+// встать в очередь упражнения: присоединиться к ждущей дуэли или создать свою
+func enterDuelQueue(m Messenger, chatID int64, userID int64, exerciseID int64) {
+	if reason := exerciseLockReason(userID, exerciseID); reason != "" {
+		sendMessage(m, chatID, reason)
+		return
+	}
+	db := openDB()
+	var title string
+	err := db.QueryRow(`SELECT title FROM Exercise WHERE id = ?`, exerciseID).Scan(&title)
+	if err == sql.ErrNoRows {
+		db.Close()
+		sendMessage(m, chatID, "Упражнение не найдено")
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if duelID, _ := currentDuel(db, userID); duelID != 0 {
+		db.Close()
+		sendMessage(m, chatID, "Вы уже участвуете в дуэли. Выйти: /duel cancel")
+		return
+	}
+
+	var waitingID int64
+	err = db.QueryRow(`SELECT id FROM Duel WHERE exercise_id = ? AND status = ? AND created_at >= ? ORDER BY id LIMIT 1`,
+		exerciseID, DuelWaiting, duelWaitCutoff()).Scan(&waitingID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Fatal(err)
+	}
+	if waitingID != 0 {
+		db.Close()
+		joinDuel(m, waitingID, chatID, userID)
+		return
+	}
+
+	plan := planDuelQuestions(db, exerciseID)
+	if len(plan) == 0 {
+		db.Close()
+		sendMessage(m, chatID, "В этом упражнении пока нет вопросов")
+		return
+	}
+	code := createDuel(db, exerciseID, chatID, userID, plan)
+	unfinished := hasOpenSession(db, userID)
+	db.Close()
+	text := fmt.Sprintf("⚔️ Дуэль «%s»: ждём соперника %d мин.\nПригласите друга: %s\nили дождитесь того, кто выберет это упражнение: /duel %d\nОтменить: /duel cancel",
+		title, int(duelWaitTimeout/time.Minute), duelInvite(code), exerciseID)
+	if unfinished {
+		text += "\n\n⚠️ Незаконченная попытка упражнения прервётся, когда начнётся дуэль"
+	}
+	sendMessage(m, chatID, text)
+}
+
+// приглашение в дуэль: ссылка на бота или команда
+func duelInvite(code string) string {
+	if botUserName != "" {
+		return fmt.Sprintf("https://t.me/%s?start=%s%s", botUserName, duelStartPrefix, code)
+	}
+	return "/duel join " + code
+}
+
+// случайные вопросы дуэли: те же, что и для попытки, но без учёта истории ученика
+func planDuelQuestions(db *sql.DB, exerciseID int64) []int64 {
+	var count int
+	if err := db.QueryRow(`SELECT question_count FROM Exercise WHERE id = ?`, exerciseID).Scan(&count); err != nil {
+		log.Fatal(err)
+	}
+	if count <= 0 {
+		count = duelQuestions
+	}
+	rows, err := db.Query(`SELECT q.id FROM Question q
+		WHERE q.exercise_id = ?
+		  AND EXISTS (SELECT 1 FROM SubQuestion sq WHERE sq.question_id = q.id AND sq.direction = ? AND sq.pointing = 0)
+		ORDER BY RANDOM()
+		LIMIT ?`, exerciseID, DirectionForward, count)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+	var plan []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			log.Fatal(err)
+		}
+		plan = append(plan, id)
+	}
+	return plan
+}
+
+// создать ждущую дуэль с первым участником и вернуть код приглашения
+func createDuel(db *sql.DB, exerciseID int64, chatID int64, userID int64, plan []int64) string {
+	code := newInviteCode()
+	tx, err := db.Begin()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`INSERT INTO Duel (code, exercise_id, status, created_at) VALUES (?, ?, ?, ?)`,
+		code, exerciseID, DuelWaiting, time.Now().Unix())
+	if err != nil {
+		log.Fatal(err)
+	}
+	duelID, err := res.LastInsertId()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := tx.Exec(`INSERT INTO DuelPlayer (duel_id, user_id, chat_id) VALUES (?, ?, ?)`, duelID, userID, chatID); err != nil {
+		log.Fatal(err)
+	}
+	for i, questionID := range plan {
+		if _, err := tx.Exec(`INSERT INTO DuelQuestion (duel_id, position, question_id) VALUES (?, ?, ?)`,
+			duelID, i+1, questionID); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatal(err)
+	}
+	return code
+}
+
+// случайный код приглашения
+func newInviteCode() string {
+	var buf [6]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		log.Fatal(err)
+	}
+	return hex.EncodeToString(buf[:])
+}
+
+// принять приглашение. Приглашённый играет, даже если упражнение у него ещё закрыто
+func joinDuelByCode(m Messenger, chatID int64, userID int64, code string) {
+	db := openDB()
+	var duelID int64
+	err := db.QueryRow(`SELECT id FROM Duel WHERE code = ? AND status = ? AND created_at >= ?`,
+		code, DuelWaiting, duelWaitCutoff()).Scan(&duelID)
+	if err == sql.ErrNoRows {
+		db.Close()
+		sendMessage(m, chatID, "Приглашение недействительно или дуэль уже началась")
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	currentID, _ := currentDuel(db, userID)
+	db.Close()
+	switch currentID {
+	case 0:
+		joinDuel(m, duelID, chatID, userID)
+	case duelID:
+		sendMessage(m, chatID, "Это ваше приглашение — отправьте его сопернику")
+	default:
+		sendMessage(m, chatID, "Вы уже участвуете в дуэли. Выйти: /duel cancel")
+	}
+}
+
+// duelPlayer — участник дуэли
+type duelPlayer struct {
+	UserID int64
+	ChatID int64
+}
+
+// второй участник присоединяется: дуэль начинается у обоих
+func joinDuel(m Messenger, duelID int64, chatID int64, userID int64) {
+	db := openDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`UPDATE Duel SET status = ?, started_at = ? WHERE id = ? AND status = ?`,
+		DuelActive, time.Now().Unix(), duelID, DuelWaiting)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		sendMessage(m, chatID, "Приглашение недействительно или дуэль уже началась")
+		return
+	}
+	if _, err := tx.Exec(`INSERT INTO DuelPlayer (duel_id, user_id, chat_id) VALUES (?, ?, ?)`, duelID, userID, chatID); err != nil {
+		log.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatal(err)
+	}
+
+	var exerciseID int64
+	var title string
+	err = db.QueryRow(`SELECT e.id, e.title FROM Duel d JOIN Exercise e ON e.id = d.exercise_id WHERE d.id = ?`,
+		duelID).Scan(&exerciseID, &title)
+	if err != nil {
+		log.Fatal(err)
+	}
+	players := loadDuelPlayers(db, duelID)
+	plan := loadDuelPlan(db, duelID)
+	names := make(map[int64]string)
+	for _, p := range players {
+		names[p.UserID] = userName(db, p.UserID)
+	}
+
+	practice := exerciseTypeOf(exerciseTypeName(exerciseID)).Practice
+	for i, p := range players {
+		opponent := players[1-i]
+		nonce := startSession(p.UserID, exerciseID, DirectionForward, practice)
+		saveSessionPlan(db, p.UserID, nonce, plan)
+		if _, err := db.Exec(`UPDATE DuelPlayer SET nonce = ? WHERE duel_id = ? AND user_id = ?`, nonce, duelID, p.UserID); err != nil {
+			log.Fatal(err)
+		}
+		sendMessage(m, p.ChatID, fmt.Sprintf("⚔️ Дуэль с %s: «%s», %d вопросов. Меньше ошибок — победа, при равенстве решает скорость. Сдаться: /duel cancel",
+			names[opponent.UserID], title, len(plan)))
+		sendFirstQuestion(m, p.ChatID, p.UserID, nonce, exerciseID, DirectionForward, practice, plan)
+	}
+}
+
+// участники дуэли в порядке вступления
+func loadDuelPlayers(db *sql.DB, duelID int64) []duelPlayer {
+	rows, err := db.Query(`SELECT user_id, chat_id FROM DuelPlayer WHERE duel_id = ? ORDER BY rowid`, duelID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+	var players []duelPlayer
+	for rows.Next() {
+		var p duelPlayer
+		if err := rows.Scan(&p.UserID, &p.ChatID); err != nil {
+			log.Fatal(err)
+		}
+		players = append(players, p)
+	}
+	return players
+}
+
+// общий план вопросов дуэли
+func loadDuelPlan(db *sql.DB, duelID int64) []int64 {
+	rows, err := db.Query(`SELECT question_id FROM DuelQuestion WHERE duel_id = ? ORDER BY position`, duelID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+	var plan []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			log.Fatal(err)
+		}
+		plan = append(plan, id)
+	}
+	return plan
+}
+
+// ученик закончил попытку; true — это была попытка дуэли и экран уже показан
+func duelPlayerFinished(m Messenger, msg *tgbotapi.Message, userID int64) bool {
+	db := openDB()
+	var duelID int64
+	err := db.QueryRow(`SELECT p.duel_id
+		FROM DuelPlayer p
+		JOIN Duel d ON d.id = p.duel_id
+		JOIN ExerciseSession s ON s.user_id = p.user_id AND s.nonce = p.nonce
+		WHERE p.user_id = ? AND p.finished_at IS NULL AND d.status = ?`, userID, DuelActive).Scan(&duelID)
+	if err == sql.ErrNoRows {
+		db.Close()
+		return false
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE DuelPlayer SET finished_at = ? WHERE duel_id = ? AND user_id = ?`,
+		time.Now().Unix(), duelID, userID); err != nil {
+		log.Fatal(err)
+	}
+	var waiting int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM DuelPlayer WHERE duel_id = ? AND finished_at IS NULL`, duelID).Scan(&waiting); err != nil {
+		log.Fatal(err)
+	}
+	db.Close()
+
+	if waiting > 0 {
+		showScreen(m, msg.Chat.ID, msg.MessageID, "Все вопросы дуэли пройдены ✅\nЖдём соперника…", nil)
+		return true
+	}
+	showScreen(m, msg.Chat.ID, msg.MessageID, "Все вопросы дуэли пройдены ✅", nil)
+	finishDuel(m, duelID, 0)
+	return true
+}
+
+// выйти из дуэли: ждущая отменяется, в идущей побеждает соперник
+func leaveDuel(m Messenger, chatID int64, userID int64) {
+	db := openDB()
+	duelID, status := currentDuel(db, userID)
+	if status == DuelWaiting {
+		if _, err := db.Exec(`UPDATE Duel SET status = ?, finished_at = ? WHERE id = ?`,
+			DuelCancelled, time.Now().Unix(), duelID); err != nil {
+			log.Fatal(err)
+		}
+	}
+	db.Close()
+	switch status {
+	case "":
+		sendMessage(m, chatID, "Вы не участвуете в дуэли")
+	case DuelWaiting:
+		sendMessage(m, chatID, "Дуэль отменена")
+	default:
+		finishDuel(m, duelID, userID)
+	}
+}
+
+// duelScore — результат участника по его ответам
+type duelScore struct {
+	duelPlayer
+	Name     string
+	Answers  int
+	Mistakes int
+	Seconds  int64 // от начала дуэли до последнего ответа
+	Finished bool
+}
+
+// доля верных ответов в процентах
+func (s duelScore) accuracy() int {
+	if s.Answers == 0 {
+		return 0
+	}
+	return (s.Answers - s.Mistakes) * 100 / s.Answers
+}
+
+// s выигрывает у o: закончил, меньше ошибок, быстрее
+func (s duelScore) beats(o duelScore) bool {
+	if s.Finished != o.Finished {
+		return s.Finished
+	}
+	if s.Mistakes != o.Mistakes {
+		return s.Mistakes < o.Mistakes
+	}
+	return s.Seconds < o.Seconds
+}
+
+// результаты участников дуэли
+func duelScores(db *sql.DB, duelID int64) []duelScore {
+	rows, err := db.Query(`SELECT p.user_id, p.chat_id, p.finished_at IS NOT NULL,
+			(SELECT COUNT(*) FROM AnswerEvent a WHERE a.user_id = p.user_id AND a.nonce = p.nonce),
+			(SELECT COUNT(*) FROM AnswerEvent a WHERE a.user_id = p.user_id AND a.nonce = p.nonce AND a.is_right = 0),
+			COALESCE((SELECT MAX(a.created_at) FROM AnswerEvent a WHERE a.user_id = p.user_id AND a.nonce = p.nonce), d.started_at) - d.started_at
+		FROM DuelPlayer p
+		JOIN Duel d ON d.id = p.duel_id
+		WHERE p.duel_id = ?
+		ORDER BY p.rowid`, duelID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var scores []duelScore
+	for rows.Next() {
+		var s duelScore
+		if err := rows.Scan(&s.UserID, &s.ChatID, &s.Finished, &s.Answers, &s.Mistakes, &s.Seconds); err != nil {
+			log.Fatal(err)
+		}
+		scores = append(scores, s)
+	}
+	rows.Close()
+	for i := range scores {
+		scores[i].Name = userName(db, scores[i].UserID)
+	}
+	return scores
+}
+
+// подвести итоги и сообщить обоим; surrenderedID — кто сдался, 0 — оба закончили
+func finishDuel(m Messenger, duelID int64, surrenderedID int64) {
+	db := openDB()
+	defer db.Close()
+
+	scores := duelScores(db, duelID)
+	if surrenderedID != 0 {
+		for i := range scores {
+			scores[i].Finished = scores[i].UserID != surrenderedID
+		}
+	}
+	var winnerID int64
+	if len(scores) == 2 {
+		switch {
+		case scores[0].beats(scores[1]):
+			winnerID = scores[0].UserID
+		case scores[1].beats(scores[0]):
+			winnerID = scores[1].UserID
+		}
+	}
+	res, err := db.Exec(`UPDATE Duel SET status = ?, finished_at = ?, winner_id = ? WHERE id = ? AND status = ?`,
+		DuelFinished, time.Now().Unix(), winnerID, duelID, DuelActive)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return // итоги уже объявлены
+	}
+
+	var title string
+	if err := db.QueryRow(`SELECT e.title FROM Duel d JOIN Exercise e ON e.id = d.exercise_id WHERE d.id = ?`,
+		duelID).Scan(&title); err != nil {
+		log.Fatal(err)
+	}
+	text := duelResultText(title, scores, winnerID, surrenderedID)
+	for _, s := range scores {
+		sendMessage(m, s.ChatID, text)
+	}
+}
+
+// текст итогов дуэли
+func duelResultText(title string, scores []duelScore, winnerID int64, surrenderedID int64) string {
+	var text strings.Builder
+	text.WriteString("🏁 Дуэль «" + title + "» окончена")
+	for _, s := range scores {
+		if s.UserID == surrenderedID {
+			text.WriteString("\n" + s.Name + " — вышел из дуэли")
+			continue
+		}
+		fmt.Fprintf(&text, "\n%s — ошибок: %d, точность %d%%, время %d:%02d",
+			s.Name, s.Mistakes, s.accuracy(), s.Seconds/60, s.Seconds%60)
+		if !s.Finished {
+			text.WriteString(" (не закончил, время вышло)")
+		}
+	}
+	for _, s := range scores {
+		if s.UserID == winnerID {
+			text.WriteString("\n🏆 Победитель: " + s.Name)
+			return text.String()
+		}
+	}
+	text.WriteString("\n🤝 Ничья")
+	return text.String()
+}
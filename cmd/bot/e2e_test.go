@@ -0,0 +1,1608 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/xuri/excelize/v2"
+)
+
+// newTestDB создаёт временную базу из testdata/fixture.sql и подменяет dbPath
+func newTestDB(t *testing.T) {
+	t.Helper()
+	fixture, err := os.ReadFile(filepath.Join("testdata", "fixture.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "bot.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(string(fixture)); err != nil {
+		t.Fatalf("не удалось загрузить фикстуру: %v", err)
+	}
+	ensureSchema(db)
+
+	oldPath := dbPath
+	dbPath = path
+	t.Cleanup(func() { dbPath = oldPath })
+}
+
+// testChat — диалог одного пользователя с ботом через fakeMessenger
+type testChat struct {
+	t        *testing.T
+	m        *fakeMessenger
+	chatID   int64
+	name     string // имя пользователя; пусто — «Тест»
+	updateID int
+}
+
+func newTestChat(t *testing.T) *testChat {
+	newTestDB(t)
+	return &testChat{t: t, m: newFakeMessenger(), chatID: 1001}
+}
+
+// second — ещё один пользователь в том же боте; update_id пользователей не пересекаются
+func (c *testChat) second(chatID int64, name string) *testChat {
+	return &testChat{t: c.t, m: c.m, chatID: chatID, name: name, updateID: int(chatID) * 1000}
+}
+
+func (c *testChat) user() *tgbotapi.User {
+	name := c.name
+	if name == "" {
+		name = "Тест"
+	}
+	return &tgbotapi.User{ID: c.chatID, FirstName: name, LanguageCode: "ru"}
+}
+
+// send отправляет боту текстовое сообщение или команду
+func (c *testChat) send(text string) {
+	c.updateID++
+	msg := &tgbotapi.Message{
+		MessageID: 10000 + c.updateID,
+		From:      c.user(),
+		Chat:      &tgbotapi.Chat{ID: c.chatID, Type: "private"},
+		Text:      text,
+	}
+	if strings.HasPrefix(text, "/") {
+		command := strings.SplitN(text, " ", 2)[0]
+		msg.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}}
+	}
+	processUpdate(c.m, tgbotapi.Update{UpdateID: c.updateID, Message: msg})
+}
+
+// press нажимает первую кнопку с текстом label в сообщении msg
+func (c *testChat) press(msg *fakeMessage, label string) {
+	c.t.Helper()
+	for _, button := range msg.buttons() {
+		if button.Text == label && button.CallbackData != nil {
+			c.updateID++
+			callback := &tgbotapi.CallbackQuery{
+				ID:   fmt.Sprintf("cb%d", c.updateID),
+				From: c.user(),
+				Message: &tgbotapi.Message{
+					MessageID: msg.MessageID,
+					Chat:      &tgbotapi.Chat{ID: msg.ChatID, Type: "private"},
+					Text:      msg.Text,
+				},
+				Data: *button.CallbackData,
+			}
+			processUpdate(c.m, tgbotapi.Update{UpdateID: c.updateID, CallbackQuery: callback})
+			return
+		}
+	}
+	c.t.Fatalf("нет кнопки %q в сообщении %q", label, msg.Text)
+}
+
+// openExercise проходит путь /start → Комбинаторика → упражнение
+func (c *testChat) openExercise(title string) *fakeMessage {
+	c.t.Helper()
+	c.press(c.openCard(title), "▶ Начать")
+	return c.m.lastSent(c.t)
+}
+
+// openCard открывает карточку упражнения из списка
+func (c *testChat) openCard(title string) *fakeMessage {
+	c.t.Helper()
+	c.send("/start")
+	c.press(c.m.lastSent(c.t), "Комбинаторика")
+	c.press(c.m.lastSent(c.t), title)
+	return c.m.lastSent(c.t)
+}
+
+// answerAll нажимает правильные варианты по порядку
+func (c *testChat) answerAll(msg *fakeMessage, answers ...string) {
+	c.t.Helper()
+	for _, answer := range answers {
+		c.press(msg, answer)
+	}
+}
+
+func TestStartShowsSections(t *testing.T) {
+	c := newTestChat(t)
+	c.send("/start")
+
+	msg := c.m.lastSent(t)
+	if !strings.HasPrefix(msg.Text, "Привет!") {
+		t.Errorf("неожиданное приветствие: %q", msg.Text)
+	}
+	var labels []string
+	for _, button := range msg.buttons() {
+		labels = append(labels, button.Text)
+	}
+	if strings.Join(labels, ",") != "Комбинаторика,Аудирование" {
+		t.Errorf("кнопки разделов: %v", labels)
+	}
+}
+
+func TestHelpListsCommands(t *testing.T) {
+	c := newTestChat(t)
+	c.send("/help")
+
+	text := c.m.lastSent(t).Text
+	for _, cmd := range []string{"/start", "/help"} {
+		if !strings.Contains(text, cmd) {
+			t.Errorf("в /help нет %s: %q", cmd, text)
+		}
+	}
+}
+
+func TestUnknownTextMessage(t *testing.T) {
+	c := newTestChat(t)
+	c.send("привет")
+
+	if got := c.m.lastSent(t).Text; !strings.Contains(got, "не понимаю") {
+		t.Errorf("ответ на произвольный текст: %q", got)
+	}
+}
+
+func TestExerciseListShowsAllExercises(t *testing.T) {
+	c := newTestChat(t)
+	c.send("/start")
+	c.press(c.m.lastSent(t), "Комбинаторика")
+
+	msg := c.m.lastSent(t)
+	if msg.Text != "Выберите упражнение" {
+		t.Errorf("заголовок списка: %q", msg.Text)
+	}
+	if titles := buttonLabels(msg); strings.Join(titles, ",") != "level1,level2" {
+		t.Errorf("упражнения: %v", titles)
+	}
+	if len(c.m.sent) != 1 {
+		t.Error("список упражнений должен заменять приветствие, а не приходить новым сообщением")
+	}
+}
+
+func TestExerciseListMarksProgress(t *testing.T) {
+	c := newTestChat(t)
+	c.openExercise("level2")
+	c.send("/start")
+	list := c.m.lastSent(t)
+	c.press(list, "Комбинаторика")
+	if got := buttonLabels(list); strings.Join(got, ",") != "level1,▶ level2" {
+		t.Errorf("отметки после начала упражнения: %v", got)
+	}
+}
+
+func TestExerciseListPagesAndGroups(t *testing.T) {
+	c := newTestChat(t)
+	db := openDB()
+	for i := 1; i <= exercisesPerPage+2; i++ {
+		if _, err := db.Exec(`INSERT INTO Exercise (title, topic) VALUES (?, 'Глаголы')`, fmt.Sprintf("extra%02d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	c.send("/start")
+	msg := c.m.lastSent(t)
+	c.press(msg, "Комбинаторика")
+	if got := buttonLabels(msg); strings.Join(got, ",") != "Без уровня (0/2 ✅),Глаголы (0/10 ✅)" {
+		t.Fatalf("выбор темы: %q %v", msg.Text, got)
+	}
+
+	c.press(msg, "Глаголы (0/10 ✅)")
+	if !strings.Contains(msg.Text, "Выберите упражнение\nГлаголы\nСтраница 1 из 2") {
+		t.Errorf("первая страница: %q", msg.Text)
+	}
+	labels := buttonLabels(msg)
+	if len(labels) != exercisesPerPage+2 || labels[0] != "extra01" || labels[exercisesPerPage] != "Вперёд ➡️" {
+		t.Errorf("кнопки первой страницы: %v", labels)
+	}
+
+	c.press(msg, "Вперёд ➡️")
+	if got := buttonLabels(msg); strings.Join(got, ",") != "extra09,extra10,⬅️ Назад,⬆️ К темам" {
+		t.Errorf("вторая страница: %v", got)
+	}
+	c.press(msg, "⬆️ К темам")
+	if !strings.HasSuffix(msg.Text, "Выберите тему") || len(c.m.sent) != 1 {
+		t.Errorf("возврат к темам: %q, отправлено сообщений %d", msg.Text, len(c.m.sent))
+	}
+}
+
+func TestExercisesListedByLevelWithDescription(t *testing.T) {
+	c := newTestChat(t)
+	db := openDB()
+	_, err := db.Exec(`UPDATE Exercise SET level = 1, position = 2 WHERE title = 'level1';
+		UPDATE Exercise SET level = 1, position = 1, description = 'Глагол «читать» в настоящем времени' WHERE title = 'level2';
+		INSERT INTO Exercise (title, level) VALUES ('level3', 2);`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.send("/start")
+	msg := c.m.lastSent(t)
+	c.press(msg, "Комбинаторика")
+	if got := buttonLabels(msg); !strings.HasPrefix(msg.Text, "Выберите уровень") ||
+		strings.Join(got, ",") != "Уровень 1 (0/2 ✅),Уровень 2 (0/1 ✅)" {
+		t.Fatalf("выбор уровня: %q %v", msg.Text, got)
+	}
+	c.press(msg, "Уровень 1 (0/2 ✅)")
+	if got := buttonLabels(msg); strings.Join(got, ",") != "level2,level1,⬆️ К темам" {
+		t.Errorf("порядок внутри уровня: %v", got)
+	}
+
+	c.press(msg, "level2")
+	if msg.Text != "level2 (уровень 1)\n\nГлагол «читать» в настоящем времени" {
+		t.Errorf("карточка упражнения: %q", msg.Text)
+	}
+	sentBefore := len(c.m.sent)
+	c.press(msg, "▶ Начать")
+	if len(c.m.sent) != sentBefore+1 || !strings.Contains(c.m.lastSent(t).Text, "я читаю") {
+		t.Errorf("упражнение не началось после описания")
+	}
+}
+
+func TestLevelUnlocksAfterAccuratePreviousLevel(t *testing.T) {
+	c := newTestChat(t)
+	db := openDB()
+	_, err := db.Exec(`UPDATE Exercise SET level = 1 WHERE title = 'level1';
+		UPDATE Exercise SET level = 2, unlock_accuracy = 80 WHERE title = 'level2';`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.send("/start")
+	msg := c.m.lastSent(t)
+	c.press(msg, "Комбинаторика")
+	c.press(msg, "Уровень 2 (0/1 ✅)")
+	c.press(msg, "🔒 level2")
+	if msg.Text != "Выберите упражнение\nУровень 2" || len(c.m.sent) != 1 {
+		t.Fatalf("закрытое упражнение открылось: %q", msg.Text)
+	}
+
+	// уровень 1 пройден с одной ошибкой: 9 верных из 10 нажатий = 90%
+	c.press(msg, "⬆️ К темам")
+	c.press(msg, "Уровень 1 (0/1 ✅)")
+	c.press(msg, "level1")
+	c.press(msg, "▶ Начать")
+	first := c.m.lastSent(t)
+	c.answerAll(first, "Мин", "Сез", "бетер", "ә", "сез")
+	c.answerAll(c.m.lastSent(t), "Без", "бетер", "ер", "без")
+
+	db = openDB()
+	db.Exec(`UPDATE Exercise SET unlock_accuracy = 100 WHERE title = 'level2'`)
+	db.Close()
+	if reason := exerciseLockReason(c.chatID, 2); reason == "" || !listedLocked(t, c.chatID, 2) {
+		t.Error("упражнение открылось при недостаточной точности")
+	}
+
+	db = openDB()
+	db.Exec(`UPDATE Exercise SET unlock_accuracy = 80 WHERE title = 'level2'`)
+	db.Close()
+	if reason := exerciseLockReason(c.chatID, 2); reason != "" || listedLocked(t, c.chatID, 2) {
+		t.Errorf("упражнение не открылось: %s", reason)
+	}
+}
+
+// listedLocked — упражнение отмечено закрытым в списке ученика
+func listedLocked(t *testing.T, userID int64, exerciseID int64) bool {
+	t.Helper()
+	for _, entry := range loadExerciseEntries(userID) {
+		if entry.ID == exerciseID {
+			return entry.Locked
+		}
+	}
+	t.Fatalf("упражнения %d нет в списке", exerciseID)
+	return false
+}
+
+func TestTeacherBypassAndManualUnlock(t *testing.T) {
+	c := newTestChat(t)
+	db := openDB()
+	_, err := db.Exec(`UPDATE Exercise SET level = 1 WHERE title = 'level1';
+		UPDATE Exercise SET level = 2, unlock_accuracy = 50 WHERE title = 'level2';`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const student = 5005
+	if exerciseLockReason(student, 2) == "" || !listedLocked(t, student, 2) {
+		t.Fatal("упражнение должно быть закрыто для нового ученика")
+	}
+
+	setUserRole(c.chatID, RoleTeacher)
+	if reason := exerciseLockReason(c.chatID, 2); reason != "" || listedLocked(t, c.chatID, 2) {
+		t.Errorf("учитель не может открыть упражнение: %s", reason)
+	}
+	c.send("/unlock 5005 2")
+	if got := c.m.lastSent(t).Text; !strings.Contains(got, "недоступна") {
+		t.Errorf("учитель вызвал /unlock: %q", got)
+	}
+
+	setUserRole(c.chatID, RoleAdmin)
+	c.send("/unlock 5005 2")
+	if got := c.m.lastSent(t).Text; got != "Упражнение «level2» открыто пользователю 5005" {
+		t.Errorf("ответ /unlock: %q", got)
+	}
+	if reason := exerciseLockReason(student, 2); reason != "" || listedLocked(t, student, 2) {
+		t.Errorf("упражнение не открылось вручную: %s", reason)
+	}
+}
+
+// createCourse создаёт курс «Основы» из двух юнитов: level1 и level2
+func createCourse(t *testing.T, autoAdvance bool) {
+	t.Helper()
+	db := openDB()
+	defer db.Close()
+	_, err := db.Exec(`INSERT INTO Course (id, title, auto_advance) VALUES (1, 'Основы', ?);
+		INSERT INTO CourseUnit (id, course_id, position, title) VALUES (1, 1, 1, 'Юнит 1'), (2, 1, 2, 'Юнит 2');
+		INSERT INTO CourseExercise (unit_id, exercise_id, position) VALUES (1, 1, 1), (2, 2, 1);`, autoAdvance)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCourseOffersNextExercise(t *testing.T) {
+	c := newTestChat(t)
+	createCourse(t, false)
+
+	c.send("/start")
+	msg := c.m.lastSent(t)
+	c.press(msg, "Комбинаторика")
+	c.press(msg, "📚 Курсы")
+	c.press(msg, "Основы (0/2 ✅)")
+	if !strings.HasPrefix(msg.Text, "📚 Основы\nПрогресс: 0/2") || !strings.Contains(msg.Text, "Юнит 2 — 0/1") {
+		t.Fatalf("карточка курса: %q", msg.Text)
+	}
+	c.press(msg, "▶ Продолжить: level1")
+	c.press(msg, "▶ Начать")
+
+	exercise := c.m.lastSent(t)
+	c.answerAll(exercise, "Сез", "бетер", "ә", "сез")
+	c.answerAll(c.m.lastSent(t), "Без", "бетер", "ер", "без")
+	final := c.m.lastSent(t)
+	if final.Text != "Упражнение закончено ✅\n\n📚 Основы: 1/2" {
+		t.Errorf("итог упражнения курса: %q", final.Text)
+	}
+	if got := buttonLabels(final); len(got) == 0 || got[0] != "▶ Дальше: level2" {
+		t.Errorf("следующее упражнение не предложено: %v", got)
+	}
+
+	c.send("/continue")
+	next := c.m.lastSent(t)
+	if !strings.Contains(next.Text, "я читаю") {
+		t.Fatalf("/continue не продолжил курс: %q", next.Text)
+	}
+	c.answerAll(next, "Мин", "укы", "ым")
+	if !strings.HasSuffix(next.Text, "Курс пройден 🎉") {
+		t.Errorf("завершение курса: %q", next.Text)
+	}
+}
+
+func TestCourseAutoAdvance(t *testing.T) {
+	c := newTestChat(t)
+	createCourse(t, true)
+	setCurrentCourse(c.chatID, 1)
+
+	c.send("/continue")
+	exercise := c.m.lastSent(t)
+	c.answerAll(exercise, "Сез", "бетер", "ә", "сез")
+	c.answerAll(c.m.lastSent(t), "Без", "бетер", "ер", "без")
+	if got := c.m.lastSent(t).Text; !strings.Contains(got, "я читаю") {
+		t.Errorf("следующее упражнение не запустилось автоматически: %q", got)
+	}
+}
+
+func TestContinueWithoutCourseShowsCourses(t *testing.T) {
+	c := newTestChat(t)
+	createCourse(t, false)
+	c.send("/continue")
+	if got := buttonLabels(c.m.lastSent(t)); len(got) == 0 || got[0] != "Основы (0/2 ✅)" {
+		t.Errorf("список курсов: %v", got)
+	}
+}
+
+// buttonLabels возвращает подписи всех кнопок сообщения
+func buttonLabels(msg *fakeMessage) []string {
+	var labels []string
+	for _, button := range msg.buttons() {
+		labels = append(labels, button.Text)
+	}
+	return labels
+}
+
+func TestStaleAnswerButtonRejected(t *testing.T) {
+	c := newTestChat(t)
+	msg := c.openExercise("level1")
+	stale := *msg // клавиатура первого подвопроса
+	c.press(msg, "Сез")
+
+	// та же подписанная кнопка из уже отвеченного подвопроса той же попытки
+	c.press(&stale, "Сез")
+	db := openDB()
+	defer db.Close()
+	var events int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM AnswerEvent WHERE user_id = ?`, c.chatID).Scan(&events); err != nil {
+		t.Fatal(err)
+	}
+	if events != 1 {
+		t.Errorf("старая кнопка записала ответ: событий %d", events)
+	}
+	c.answerAll(msg, "бетер", "ә", "сез")
+	if !strings.HasSuffix(msg.Text, "Перевод: <b>Сез бетерәсез</b> ✅") {
+		t.Errorf("вопрос после старой кнопки: %q", msg.Text)
+	}
+}
+
+func TestPlayWholeExercise(t *testing.T) {
+	c := newTestChat(t)
+	first := c.openExercise("level1")
+	if !strings.Contains(first.Text, "вы заканчиваете") {
+		t.Fatalf("первый вопрос: %q", first.Text)
+	}
+
+	c.answerAll(first, "Сез")
+	c.answerAll(first, "бетер", "ә", "сез")
+	if !strings.HasSuffix(first.Text, "Перевод: <b>Сез бетерәсез</b> ✅") {
+		t.Errorf("собранный ответ на первый вопрос: %q", first.Text)
+	}
+	if first.buttons() != nil {
+		t.Error("после ответа на вопрос клавиатура должна исчезнуть")
+	}
+
+	second := c.m.lastSent(t)
+	if !strings.Contains(second.Text, "мы закончим") {
+		t.Fatalf("второй вопрос: %q", second.Text)
+	}
+	c.answerAll(second, "Без", "бетер", "ер", "без")
+	if second.Text != "Упражнение закончено ✅\n\nВыберите упражнение" {
+		t.Errorf("финальное сообщение: %q", second.Text)
+	}
+	if got := buttonLabels(second); strings.Join(got, ",") != "⭐ Рекомендуем: level2,✅ level1,level2" {
+		t.Errorf("после упражнения ожидался список упражнений с отметкой, получено %v", got)
+	}
+	if len(c.m.callbacks) == 0 {
+		t.Error("нажатия кнопок не подтверждены")
+	}
+}
+
+func TestPointingRunsAreConcatenated(t *testing.T) {
+	c := newTestChat(t)
+	db := openDB()
+	_, err := db.Exec(`INSERT INTO Exercise (id, title) VALUES (3, 'level3');
+		INSERT INTO Question (id, exercise_id, text) VALUES (30, 3, '«я читаю, ты пишешь.»');
+		INSERT INTO SubQuestion (id, question_id, seq_num, pointing, text) VALUES
+			(300, 30, 1, 1, '«'),
+			(301, 30, 2, 0, 'Мин'),
+			(302, 30, 3, 1, ' '),
+			(303, 30, 4, 0, 'укыйм'),
+			(304, 30, 5, 1, ','),
+			(305, 30, 6, 1, ' '),
+			(306, 30, 7, 0, 'син'),
+			(307, 30, 8, 1, ' '),
+			(308, 30, 9, 0, 'язасың'),
+			(309, 30, 10, 1, '.'),
+			(310, 30, 11, 1, '»');
+		INSERT INTO Option (sub_question_id, text) VALUES
+			(301, 'Мин'), (301, 'Син'),
+			(303, 'укыйм'), (303, 'язам'),
+			(306, 'син'), (306, 'мин'),
+			(308, 'язасың'), (308, 'укыйсың');`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := c.openExercise("level3")
+	if !strings.HasSuffix(msg.Text, "Перевод: <b>«</b>") {
+		t.Fatalf("пунктуация в начале предложения не показана: %q", msg.Text)
+	}
+	c.press(msg, "Мин")
+	c.press(msg, "укыйм")
+	if !strings.HasSuffix(msg.Text, "<b>«Мин укыйм,</b>") {
+		t.Errorf("две строки пунктуации подряд: %q", msg.Text)
+	}
+	c.answerAll(msg, "син", "язасың")
+
+	edits := c.m.edits
+	var answered string
+	for _, edit := range edits {
+		if edit.MessageID == msg.MessageID && strings.HasSuffix(edit.Text, " ✅") {
+			answered = edit.Text
+		}
+	}
+	if !strings.HasSuffix(answered, "<b>«Мин укыйм, син язасың.»</b> ✅") {
+		t.Errorf("пунктуация в конце предложения: %q", answered)
+	}
+}
+
+func TestExerciseMessageIsEscapedHTML(t *testing.T) {
+	c := newTestChat(t)
+	db := openDB()
+	_, err := db.Exec(`UPDATE Question SET text = 'я <читаю> & пишу' WHERE id = 20`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := c.openExercise("level2")
+	if !msg.HTML {
+		t.Fatal("сообщение упражнения должно быть в HTML")
+	}
+	want := "Вопрос 1/1 · слово 1/3\nПереведите предложение:\n<i>я &lt;читаю&gt; &amp; пишу</i>\nПеревод:"
+	if msg.Text != want {
+		t.Errorf("первый вопрос:\n%q\nожидалось\n%q", msg.Text, want)
+	}
+
+	c.press(msg, "Мин")
+	if !strings.HasPrefix(msg.Text, "Вопрос 1/1 · слово 2/3\n") || !strings.HasSuffix(msg.Text, "Перевод: <b>Мин</b>") {
+		t.Errorf("после первого слова: %q", msg.Text)
+	}
+	c.press(msg, "яз")
+	if !strings.HasSuffix(msg.Text, "Перевод: <b>Мин</b>") || !msg.HTML {
+		t.Errorf("неверный ответ должен сохранить разметку: %q", msg.Text)
+	}
+}
+
+func TestTypedWordsMode(t *testing.T) {
+	c := newTestChat(t)
+	db := openDB()
+	if _, err := db.Exec(`UPDATE Exercise SET answer_mode = 'words' WHERE id = 1`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	question := c.openExercise("level1")
+	if got := strings.Join(buttonLabels(question), ","); got != "ә,ө,ү,җ,ң,һ" || !strings.Contains(question.Text, "Напишите следующее слово") {
+		t.Fatalf("в режиме ввода вместо вариантов экранные буквы: %s %q", got, question.Text)
+	}
+	if !strings.HasPrefix(question.Text, "Вопрос 1/2 · слово 1/2") {
+		t.Errorf("слова считаются вместе с аффиксами: %q", question.Text)
+	}
+
+	c.send("сез")
+	if !strings.Contains(question.Text, "Перевод: <b>Сез</b>") {
+		t.Errorf("после первого слова: %q", question.Text)
+	}
+	c.send("бетерәсес")
+	if got := c.m.lastSent(t).Text; got != "Почти — проверьте окончание" {
+		t.Errorf("опечатка в аффиксе: %q", got)
+	}
+	c.send("бетерэсез")
+	if got := c.m.sent[len(c.m.sent)-2].Text; !strings.HasPrefix(got, "Верно! Обратите внимание") {
+		t.Errorf("замена татарской буквы: %q", got)
+	}
+	if !strings.HasSuffix(question.Text, "Перевод: <b>Сез бетерәсез</b> ✅") {
+		t.Errorf("собранный вопрос: %q", question.Text)
+	}
+
+	second := c.m.lastSent(t)
+	if !strings.Contains(second.Text, "мы закончим") {
+		t.Fatalf("второй вопрос: %q", second.Text)
+	}
+	c.send("Без")
+	c.send("бетерербез")
+	if got := c.m.lastSent(t).Text; got != "Упражнение закончено ✅\n\nВыберите упражнение" {
+		t.Errorf("финальное сообщение: %q", got)
+	}
+
+	c.send("ещё текст")
+	if got := c.m.lastSent(t).Text; !strings.HasPrefix(got, "Я не понимаю") {
+		t.Errorf("после упражнения текст не должен считаться ответом: %q", got)
+	}
+}
+
+func TestTatarLettersCompose(t *testing.T) {
+	c := newTestChat(t)
+	db := openDB()
+	if _, err := db.Exec(`UPDATE Exercise SET answer_mode = 'words' WHERE id = 1`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	question := c.openExercise("level1")
+	c.send("Сез")
+	// слово, написанное сообщением целиком, проверяется сразу
+	c.send("бетер")
+	if got := c.m.lastSent(t).Text; got != "Почти — проверьте окончание" {
+		t.Errorf("основа без аффикса: %q", got)
+	}
+	if strings.Contains(question.Text, "Набрано") {
+		t.Fatalf("написанное сообщением не попадает в набор: %q", question.Text)
+	}
+
+	c.press(question, "ә")
+	if got := strings.Join(buttonLabels(question), ","); got != "ә,ө,ү,җ,ң,һ,⌫,✅ Проверить" {
+		t.Errorf("кнопки при наборе: %s", got)
+	}
+	c.press(question, "⌫")
+	if strings.Contains(question.Text, "Набрано") {
+		t.Fatalf("стёртый набор: %q", question.Text)
+	}
+
+	// набор, начатый экранными буквами, дописывается сообщениями
+	db = openDB()
+	if _, err := db.Exec(`UPDATE ExerciseSession SET compose = 'бетер' WHERE user_id = ?`, c.chatID); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	c.press(question, "ө")
+	c.press(question, "⌫")
+	c.press(question, "ә")
+	if !strings.Contains(question.Text, "Набрано: <code>бетерә</code>") {
+		t.Fatalf("буквы и стирание: %q", question.Text)
+	}
+	sent := len(c.m.sent)
+	c.send("с")
+	if len(c.m.sent) != sent {
+		t.Errorf("начало правильного слова в наборе не должно считаться ошибкой: %q", c.m.lastSent(t).Text)
+	}
+	if !strings.Contains(question.Text, "Набрано: <code>бетерәс</code>") {
+		t.Fatalf("текст дописан к набору: %q", question.Text)
+	}
+	c.send("ез")
+	if !strings.HasSuffix(question.Text, "Перевод: <b>Сез бетерәсез</b> ✅") {
+		t.Errorf("слово из набора и текста: %q", question.Text)
+	}
+
+	second := c.m.lastSent(t)
+	c.press(second, "ң")
+	c.press(second, "✅ Проверить")
+	if got := c.m.lastSent(t).Text; !strings.HasPrefix(got, "❌") {
+		t.Errorf("неверный набор: %q", got)
+	}
+	if strings.Contains(second.Text, "Набрано") {
+		t.Errorf("после проверки набор очищается: %q", second.Text)
+	}
+}
+
+func TestLatinScript(t *testing.T) {
+	c := newTestChat(t)
+	c.send("/script latin")
+	if got := c.m.lastSent(t).Text; !strings.Contains(got, "латиницей") {
+		t.Fatalf("ответ на /script: %q", got)
+	}
+
+	msg := c.openExercise("level1")
+	if got := strings.Join(buttonLabels(msg), ","); !strings.Contains(got, "Sez") || strings.Contains(got, "Сез") {
+		t.Errorf("варианты латиницей: %s", got)
+	}
+	if !strings.Contains(msg.Text, "<i>вы заканчиваете</i>") {
+		t.Errorf("русское предложение остаётся кириллицей: %q", msg.Text)
+	}
+	c.answerAll(msg, "Sez", "beter", "ä", "sez")
+	if !strings.HasSuffix(msg.Text, "Перевод: <b>Sez beteräsez</b> ✅") {
+		t.Errorf("поле ответа латиницей: %q", msg.Text)
+	}
+}
+
+func TestLatinTypedAnswer(t *testing.T) {
+	c := newTestChat(t)
+	db := openDB()
+	if _, err := db.Exec(`UPDATE Exercise SET answer_mode = 'words' WHERE id = 1`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	c.send("/script latin")
+
+	question := c.openExercise("level1")
+	if got := strings.Join(buttonLabels(question), ","); got != "ä,ö,ü,ç,ğ,ı,ñ,ş" {
+		t.Errorf("латинские экранные буквы: %s", got)
+	}
+	c.send("Sez")
+	c.send("beter")
+	if got := c.m.lastSent(t).Text; got != "Почти — проверьте окончание" {
+		t.Errorf("основа латиницей без аффикса: %q", got)
+	}
+	c.send("beteräsez")
+	if !strings.HasSuffix(question.Text, "Перевод: <b>Sez beteräsez</b> ✅") {
+		t.Errorf("ответ латиницей: %q", question.Text)
+	}
+}
+
+func TestTypedSentenceMode(t *testing.T) {
+	c := newTestChat(t)
+	db := openDB()
+	if _, err := db.Exec(`UPDATE Exercise SET answer_mode = 'sentence' WHERE id = 2`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	question := c.openExercise("level2")
+	if !strings.Contains(question.Text, "Напишите перевод целиком") {
+		t.Fatalf("подсказка режима: %q", question.Text)
+	}
+	c.send("Мин язам")
+	if got := c.m.lastSent(t).Text; !strings.HasPrefix(got, "❌") {
+		t.Errorf("неверный перевод: %q", got)
+	}
+	c.send("мин укыым.")
+	if !strings.HasSuffix(question.Text, "<b>Мин укыым</b> ✅") {
+		t.Errorf("собранный вопрос: %q", question.Text)
+	}
+}
+
+func TestReverseDirection(t *testing.T) {
+	c := newTestChat(t)
+	db := openDB()
+	_, err := db.Exec(`INSERT INTO SubQuestion (id, question_id, seq_num, pointing, joiner, direction, text) VALUES
+			(210, 20, 5, 0, 'word', 'ru', 'Я'),
+			(211, 20, 6, 0, 'word', 'ru', 'читаю');
+		INSERT INTO Option (sub_question_id, text) VALUES
+			(210, 'Я'), (210, 'Ты'),
+			(211, 'читаю'), (211, 'пишу');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	c.send("/script latin")
+
+	card := c.openCard("level2")
+	c.press(card, "▶ Начать")
+	if got := strings.Join(buttonLabels(c.m.lastSent(t)), ","); strings.Contains(got, "Ты") {
+		t.Errorf("в прямом направлении русских вариантов нет: %s", got)
+	}
+
+	c.press(card, "🔄 С татарского на русский")
+	msg := c.m.lastSent(t)
+	if !strings.Contains(msg.Text, "Переведите на русский:\n<i>Min uqıım</i>") {
+		t.Fatalf("татарское предложение в задании: %q", msg.Text)
+	}
+	if got := strings.Join(buttonLabels(msg), ","); !strings.Contains(got, "Ты") {
+		t.Errorf("русские варианты без транслитерации: %s", got)
+	}
+	c.answerAll(msg, "Я", "читаю")
+	if last := c.m.edits[len(c.m.edits)-2].Text; !strings.HasSuffix(last, "Перевод: <b>Я читаю</b> ✅") {
+		t.Errorf("собранный русский перевод: %q", last)
+	}
+}
+
+func TestWordOrderPractice(t *testing.T) {
+	c := newTestChat(t)
+	c.press(c.openCard("level1"), "🔀 Порядок слов")
+	msg := c.m.lastSent(t)
+	if !strings.Contains(msg.Text, "Нажимайте части предложения по порядку") {
+		t.Fatalf("подсказка режима: %q", msg.Text)
+	}
+	labels := buttonLabels(msg)
+	sort.Strings(labels)
+	if strings.Join(labels, ",") != "Сез,бетерәсез" {
+		t.Fatalf("части предложения: %v", labels)
+	}
+
+	c.press(msg, "бетерәсез")
+	if got := strings.Join(buttonLabels(msg), ","); !strings.Contains(got, "❌ бетерәсез") {
+		t.Errorf("неверная часть не отмечена: %s", got)
+	}
+	c.press(msg, "Сез")
+	if !strings.Contains(msg.Text, "Перевод: <b>Сез</b>") || strings.Join(buttonLabels(msg), ",") != "бетерәсез" {
+		t.Errorf("после первой части: %q %v", msg.Text, buttonLabels(msg))
+	}
+	c.press(msg, "бетерәсез")
+	if !strings.HasSuffix(msg.Text, "Перевод: <b>Сез бетерәсез</b> ✅") {
+		t.Errorf("собранное предложение: %q", msg.Text)
+	}
+
+	second := c.m.lastSent(t)
+	c.answerAll(second, "Без", "бетерербез")
+	if !strings.HasPrefix(second.Text, "Упражнение закончено ✅") {
+		t.Errorf("итог упражнения: %q", second.Text)
+	}
+
+	db := openDB()
+	defer db.Close()
+	var wrong, right int
+	if err := db.QueryRow(`SELECT COALESCE(SUM(is_right = 0), 0), COALESCE(SUM(is_right = 1), 0) FROM AnswerEvent WHERE user_id = ?`,
+		c.chatID).Scan(&wrong, &right); err != nil {
+		t.Fatal(err)
+	}
+	if wrong != 1 || right != 4 {
+		t.Errorf("записано ответов: %d неверных, %d верных", wrong, right)
+	}
+}
+
+func TestChoiceExercise(t *testing.T) {
+	c := newTestChat(t)
+	db := openDB()
+	_, err := db.Exec(`INSERT INTO Exercise (id, title, type) VALUES (3, 'choice', 'choice');
+		INSERT INTO Question (id, exercise_id, text) VALUES (30, 3, 'Как будет «книга»?');
+		INSERT INTO SubQuestion (id, question_id, seq_num, pointing, text) VALUES (300, 30, 1, 0, 'китап');
+		INSERT INTO Option (sub_question_id, text) VALUES (300, 'китап'), (300, 'дәфтәр');`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	card := c.openCard("choice")
+	if got := strings.Join(buttonLabels(card), ","); got != "▶ Начать,⬅️ К списку" {
+		t.Errorf("у выбора ответа нет режимов перевода: %s", got)
+	}
+	c.press(card, "▶ Начать")
+	msg := c.m.lastSent(t)
+	if msg.Text != "Вопрос 1/1\n<b>Как будет «книга»?</b>" {
+		t.Errorf("вопрос: %q", msg.Text)
+	}
+	// кнопки перемешаны: верный вариант ищем по тексту
+	if got := sortedLabels(msg); got != "дәфтәр,китап" {
+		t.Errorf("варианты: %s", got)
+	}
+	c.press(msg, "дәфтәр")
+	c.press(msg, "китап")
+	if !strings.Contains(c.m.edits[len(c.m.edits)-2].Text, "Ответ: <b>китап</b> ✅") {
+		t.Errorf("ответ не показан: %q", c.m.edits[len(c.m.edits)-2].Text)
+	}
+}
+
+func TestClozeExercise(t *testing.T) {
+	c := newTestChat(t)
+	db := openDB()
+	_, err := db.Exec(`INSERT INTO Exercise (id, title, type) VALUES (3, 'cloze', 'cloze');
+		INSERT INTO Question (id, exercise_id, text) VALUES (30, 3, 'я читаю книгу');
+		INSERT INTO SubQuestion (id, question_id, seq_num, pointing, text) VALUES
+			(300, 30, 1, 1, 'Мин китап '),
+			(301, 30, 2, 0, 'укы'),
+			(302, 30, 3, 1, 'ым');
+		INSERT INTO Option (sub_question_id, text) VALUES (301, 'укы'), (301, 'яз');`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := c.openExercise("cloze")
+	if !strings.HasSuffix(msg.Text, "Заполните пропуски:\n<i>я читаю книгу</i>\n<b>Мин китап 👉___ым</b>") {
+		t.Errorf("предложение с пропуском: %q", msg.Text)
+	}
+	c.press(msg, "яз")
+	c.press(msg, "укы")
+	if last := c.m.edits[len(c.m.edits)-2].Text; !strings.HasSuffix(last, "<b>Мин китап укыым</b> ✅") {
+		t.Errorf("заполненное предложение: %q", last)
+	}
+}
+
+func TestMatchExercise(t *testing.T) {
+	c := newTestChat(t)
+	db := openDB()
+	_, err := db.Exec(`INSERT INTO Exercise (id, title, type) VALUES (3, 'match', 'match');
+		INSERT INTO Question (id, exercise_id, text) VALUES (30, 3, 'Сопоставьте слова');
+		INSERT INTO SubQuestion (id, question_id, seq_num, pointing, prompt, text) VALUES
+			(300, 30, 1, 0, 'книга', 'китап'),
+			(301, 30, 2, 0, 'дом', 'өй');
+		INSERT INTO Option (sub_question_id, text) VALUES
+			(300, 'китап'), (300, 'өй'),
+			(301, 'китап'), (301, 'өй');`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := c.openExercise("match")
+	if !strings.HasSuffix(msg.Text, "Сопоставьте слова\n👉 книга — ?\nдом — ?") {
+		t.Errorf("пары: %q", msg.Text)
+	}
+	c.press(msg, "китап")
+	if !strings.HasSuffix(msg.Text, "книга — <b>китап</b> ✅\n👉 дом — ?") {
+		t.Errorf("после первой пары: %q", msg.Text)
+	}
+	// последнюю пару не выдаёт единственная кнопка
+	if got := sortedLabels(msg); got != "китап,өй" {
+		t.Errorf("варианты второй пары: %s", got)
+	}
+	c.press(msg, "китап")
+	if !strings.Contains(msg.Text, "👉 дом — ?") {
+		t.Errorf("вариант первой пары принят для второй: %q", msg.Text)
+	}
+	c.press(msg, "өй")
+	if last := c.m.edits[len(c.m.edits)-2].Text; !strings.HasSuffix(last, "дом — <b>өй</b> ✅") {
+		t.Errorf("после второй пары: %q", last)
+	}
+}
+
+// sortedLabels — подписи кнопок сообщения по алфавиту: порядок кнопок
+// вариантов зависит от попытки
+func sortedLabels(msg *fakeMessage) string {
+	labels := buttonLabels(msg)
+	sort.Strings(labels)
+	return strings.Join(labels, ",")
+}
+
+// sendGroup отправляет команду в групповой чат от имени from
+func (c *testChat) sendGroup(groupID int64, from *tgbotapi.User, text string) {
+	c.updateID++
+	command := strings.SplitN(text, " ", 2)[0]
+	msg := &tgbotapi.Message{
+		MessageID: 10000 + c.updateID,
+		From:      from,
+		Chat:      &tgbotapi.Chat{ID: groupID, Type: "group"},
+		Text:      text,
+		Entities:  []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}},
+	}
+	processUpdate(c.m, tgbotapi.Update{UpdateID: c.updateID, Message: msg})
+}
+
+// answerPoll присылает ответ участника на опрос
+func (c *testChat) answerPoll(poll fakePoll, from *tgbotapi.User, option int) {
+	c.updateID++
+	answer := &tgbotapi.PollAnswer{PollID: poll.ID, User: *from, OptionIDs: []int{option}}
+	processUpdate(c.m, tgbotapi.Update{UpdateID: c.updateID, PollAnswer: answer})
+}
+
+func TestGroupQuizLeaderboard(t *testing.T) {
+	c := newTestChat(t)
+	const group = -500
+	teacher := &tgbotapi.User{ID: 2002, FirstName: "Учитель"}
+	alice := &tgbotapi.User{ID: 3001, FirstName: "Алсу"}
+	bulat := &tgbotapi.User{ID: 3002, FirstName: "Булат"}
+	setUserRole(teacher.ID, RoleTeacher)
+	setUserRole(c.chatID, RoleTeacher)
+
+	c.send("/quiz 2")
+	if got := c.m.lastSent(t).Text; !strings.Contains(got, "групповом чате") {
+		t.Errorf("викторина в личном чате: %q", got)
+	}
+
+	c.sendGroup(group, teacher, "/quiz 2")
+	if len(c.m.polls) != 3 {
+		t.Fatalf("опросов: %d, ожидалось по одному на подвопрос level2", len(c.m.polls))
+	}
+	first := c.m.polls[0]
+	if first.Question != "Переведите: я читаю\n…" || len(first.Options) != 2 || first.Options[first.Correct] != "Мин" {
+		t.Errorf("первый опрос: %+v", first)
+	}
+	if third := c.m.polls[2]; third.Question != "Переведите: я читаю\nМин укы …" {
+		t.Errorf("третий опрос: %q", third.Question)
+	}
+
+	for _, poll := range c.m.polls {
+		c.answerPoll(poll, alice, poll.Correct)
+		c.answerPoll(poll, bulat, 1-poll.Correct)
+		c.answerPoll(poll, bulat, poll.Correct) // учитывается первый ответ
+	}
+	c.sendGroup(group, teacher, "/quiz stop")
+	board := c.m.lastSent(t).Text
+	if board != "🏁 Итоги викторины «level2»\n🥇 Алсу — 3/3\n🥈 Булат — 0/3" {
+		t.Errorf("итоги: %q", board)
+	}
+	for _, poll := range c.m.polls {
+		if !poll.Closed {
+			t.Errorf("опрос %s не закрыт", poll.ID)
+		}
+	}
+
+	db := openDB()
+	defer db.Close()
+	var events int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM AnswerEvent WHERE nonce = 0 AND exercise_id = 2`).Scan(&events); err != nil {
+		t.Fatal(err)
+	}
+	if events != 6 {
+		t.Errorf("ответов викторины в AnswerEvent: %d", events)
+	}
+
+	// без /quiz stop итоги приходят, когда опросы закрылись по времени
+	c.sendGroup(group, teacher, "/quiz 2")
+	round := c.m.polls[3:]
+	for _, poll := range round {
+		if poll.Period != quizRoundPeriod {
+			t.Errorf("опрос %s открыт на %v", poll.ID, poll.Period)
+		}
+	}
+	c.answerPoll(round[0], bulat, round[0].Correct)
+	expireTimeouts(c.m)
+	if got := c.m.lastSent(t).Text; strings.HasPrefix(got, "🏁") {
+		t.Fatalf("итоги до закрытия опросов: %q", got)
+	}
+	if _, err := db.Exec(`UPDATE QuizRound SET started_at = started_at - ?`, int64(quizRoundPeriod/time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	expireTimeouts(c.m)
+	if got := c.m.lastSent(t).Text; got != "🏁 Итоги викторины «level2»\n🥇 Булат — 1/3" {
+		t.Errorf("итоги по времени: %q", got)
+	}
+	for _, poll := range round {
+		if poll.Closed {
+			t.Errorf("опрос %s закрыт Telegram, второй раз закрывать не нужно", poll.ID)
+		}
+	}
+	c.sendGroup(group, teacher, "/quiz stop")
+	if got := c.m.lastSent(t).Text; got != "Сейчас викторина не идёт" {
+		t.Errorf("раунд не закончен: %q", got)
+	}
+}
+
+func TestDuelByInvite(t *testing.T) {
+	c := newTestChat(t)
+	d := c.second(1002, "Булат")
+
+	c.send("/duel 2")
+	invite := regexp.MustCompile(`/duel join (\w+)`).FindStringSubmatch(c.m.lastSent(t).Text)
+	if invite == nil {
+		t.Fatalf("нет приглашения: %q", c.m.lastSent(t).Text)
+	}
+	c.send("/duel join " + invite[1])
+	if got := c.m.lastSent(t).Text; !strings.Contains(got, "ваше приглашение") {
+		t.Errorf("своё приглашение: %q", got)
+	}
+
+	d.send("/duel join " + invite[1])
+	first, second := c.m.lastSentTo(t, c.chatID), c.m.lastSentTo(t, d.chatID)
+	if first.Text != second.Text || !strings.Contains(first.Text, "я читаю") {
+		t.Fatalf("соперники получили разные вопросы: %q и %q", first.Text, second.Text)
+	}
+
+	c.answerAll(first, "Син", "Мин", "укы", "ым")
+	if !strings.Contains(first.Text, "Ждём соперника") {
+		t.Errorf("после ответов первого: %q", first.Text)
+	}
+	d.answerAll(second, "Мин", "укы", "ым")
+
+	for _, chatID := range []int64{c.chatID, d.chatID} {
+		result := c.m.lastSentTo(t, chatID).Text
+		if !strings.HasPrefix(result, "🏁 Дуэль «level2» окончена") ||
+			!strings.Contains(result, "Тест — ошибок: 1, точность 75%") ||
+			!strings.Contains(result, "Булат — ошибок: 0, точность 100%") ||
+			!strings.HasSuffix(result, "🏆 Победитель: Булат") {
+			t.Errorf("итоги в чате %d: %q", chatID, result)
+		}
+	}
+}
+
+func TestDuelQueueSurvivesRestartAndSurrender(t *testing.T) {
+	c := newTestChat(t)
+	d := c.second(1002, "Булат")
+
+	c.send("/duel 2")
+	// состояние дуэли только в базе: обработчики ничего не держат в памяти
+	c.m = newFakeMessenger()
+	d.m = c.m
+	d.send("/duel 2")
+	if got := c.m.lastSentTo(t, c.chatID).Text; !strings.Contains(got, "я читаю") {
+		t.Fatalf("из очереди не началась дуэль: %q", got)
+	}
+	d.send("/duel 2")
+	if got := d.m.lastSent(t).Text; !strings.Contains(got, "уже участвуете") {
+		t.Errorf("повторный вход: %q", got)
+	}
+
+	c.send("/duel cancel")
+	result := c.m.lastSentTo(t, d.chatID).Text
+	if !strings.Contains(result, "Тест — вышел из дуэли") || !strings.HasSuffix(result, "🏆 Победитель: Булат") {
+		t.Errorf("итоги после выхода: %q", result)
+	}
+	c.send("/duel cancel")
+	if got := c.m.lastSent(t).Text; got != "Вы не участвуете в дуэли" {
+		t.Errorf("выход без дуэли: %q", got)
+	}
+}
+
+func TestDuelBlocksOtherExercisesAndTimesOut(t *testing.T) {
+	c := newTestChat(t)
+	d := c.second(1002, "Булат")
+	c.send("/duel 2")
+	d.send("/duel 2")
+	question := c.m.lastSentTo(t, c.chatID)
+
+	// другая попытка заменила бы попытку дуэли
+	c.press(c.openCard("level1"), "▶ Начать")
+	if got := c.m.lastSent(t).Text; !strings.HasPrefix(got, "Сначала закончите дуэль") {
+		t.Fatalf("упражнение началось посреди дуэли: %q", got)
+	}
+	c.answerAll(question, "Мин", "укы", "ым")
+	if !strings.Contains(question.Text, "Ждём соперника") {
+		t.Fatalf("попытка дуэли потерялась: %q", question.Text)
+	}
+	// свои вопросы пройдены — можно заниматься дальше
+	if got := c.openExercise("level1").Text; !strings.Contains(got, "вы заканчиваете") {
+		t.Errorf("после своих вопросов дуэли: %q", got)
+	}
+
+	// соперник пропал: после таймаута итоги подводит проверка главного цикла
+	db := openDB()
+	idle := int64(duelIdleTimeout/time.Second) + 60
+	_, err := db.Exec(`UPDATE Duel SET started_at = started_at - ?;
+		UPDATE AnswerEvent SET created_at = created_at - ?`, idle, idle)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.send("/start")
+	if got := c.m.lastSentTo(t, d.chatID).Text; strings.HasPrefix(got, "🏁") {
+		t.Fatalf("итоги подведены обработчиком обновления: %q", got)
+	}
+	expireStaleDuels(c.m)
+	result := c.m.lastSentTo(t, d.chatID).Text
+	if !strings.Contains(result, "Булат — ошибок: 0, точность 0%, время 0:00 (не закончил, время вышло)") ||
+		!strings.HasSuffix(result, "🏆 Победитель: Тест") {
+		t.Errorf("итоги по таймауту: %q", result)
+	}
+	d.send("/duel 2")
+	if got := c.m.lastSent(t).Text; !strings.Contains(got, "ждём соперника") {
+		t.Errorf("новая дуэль после таймаута: %q", got)
+	}
+}
+
+func TestDuelWaitingExpires(t *testing.T) {
+	c := newTestChat(t)
+	d := c.second(1002, "Булат")
+
+	// незаконченную попытку дуэль прервёт — об этом предупреждаем заранее
+	c.openExercise("level1")
+	c.send("/duel 2")
+	if got := c.m.lastSent(t).Text; !strings.Contains(got, "Незаконченная попытка упражнения прервётся") {
+		t.Errorf("нет предупреждения о попытке: %q", got)
+	}
+	// пока ждём соперника, новую попытку не начать: дуэль заменила бы её
+	c.press(c.openCard("▶ level1"), "▶ Начать")
+	if got := c.m.lastSent(t).Text; !strings.HasPrefix(got, "Вы ждёте соперника в дуэли") {
+		t.Fatalf("попытка началась во время ожидания дуэли: %q", got)
+	}
+
+	// создатель ушёл: ждущая дуэль не достаётся новому сопернику и отменяется
+	db := openDB()
+	_, err := db.Exec(`UPDATE Duel SET created_at = created_at - ?`, int64(duelWaitTimeout/time.Second)+60)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.send("/duel 2")
+	if got := c.m.lastSentTo(t, d.chatID).Text; !strings.Contains(got, "ждём соперника") {
+		t.Errorf("соперник попал в брошенную дуэль: %q", got)
+	}
+	expireStaleDuels(c.m)
+	if got := c.m.lastSentTo(t, c.chatID).Text; !strings.HasPrefix(got, "⌛ Соперник не нашёлся за 30 мин") {
+		t.Errorf("отмена ждущей дуэли: %q", got)
+	}
+	if got := c.openExercise("▶ level1").Text; !strings.Contains(got, "вы заканчиваете") {
+		t.Errorf("после отмены дуэли: %q", got)
+	}
+}
+
+func TestClassroomAssignments(t *testing.T) {
+	c := newTestChat(t)
+	teacher := c.second(2002, "Учитель")
+	setUserRole(teacher.chatID, RoleTeacher)
+	db := openDB()
+	_, err := db.Exec(`UPDATE Exercise SET level = 1 WHERE title = 'level1';
+		UPDATE Exercise SET level = 2, unlock_accuracy = 80 WHERE title = 'level2';`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	teacher.send("/class new 7А")
+	code := regexp.MustCompile(`/join (\w+)`).FindStringSubmatch(c.m.lastSent(t).Text)
+	if code == nil {
+		t.Fatalf("нет кода класса: %q", c.m.lastSent(t).Text)
+	}
+	c.send("/join " + code[1])
+	if got := c.m.lastSent(t).Text; got != "Вы в классе «7А» (учитель Учитель). Задания — в меню /start" {
+		t.Errorf("вступление: %q", got)
+	}
+	c.send("/class progress 1")
+	if got := c.m.lastSent(t).Text; !strings.Contains(got, "недоступна") {
+		t.Errorf("ученику доступен прогресс класса: %q", got)
+	}
+
+	if !listedLocked(t, c.chatID, 2) {
+		t.Fatal("level2 открыт до задания")
+	}
+	teacher.send("/class assign 1 exercise 2 31.12.2099")
+	if got := c.m.lastSent(t).Text; got != "Классу «7А» задано: level2 — до 31.12.2099" {
+		t.Errorf("задание: %q", got)
+	}
+
+	// задание открывает упражнение закрытого уровня — и в списке, и при запуске
+	if reason := exerciseLockReason(c.chatID, 2); reason != "" || listedLocked(t, c.chatID, 2) {
+		t.Errorf("заданное упражнение закрыто: %q, в списке закрыто: %v", reason, listedLocked(t, c.chatID, 2))
+	}
+	c.send("/start")
+	menu := c.m.lastSent(t)
+	c.press(menu, "📝 Задания (1)")
+	if menu.Text != "📝 Задания\n⏳ level2 — до 31.12.2099 · 7А" {
+		t.Errorf("список заданий: %q", menu.Text)
+	}
+	c.press(menu, "⏳ level2 — до 31.12.2099")
+	c.press(menu, "▶ Начать")
+	c.answerAll(c.m.lastSent(t), "Син", "Мин", "укы", "ым")
+
+	teacher.send("/class progress 1")
+	progress := c.m.lastSent(t).Text
+	want := "📊 Класс «7А», учеников: 1\n1. level2 — до 31.12.2099\n\nТест — выполнено 1/1, точность 75% (ответов: 4)\n  1 ✅"
+	if progress != want {
+		t.Errorf("прогресс класса:\n%q\nожидалось\n%q", progress, want)
+	}
+
+	// большой класс не влезает в одно сообщение Telegram
+	db = openDB()
+	for i := 0; i < 120; i++ {
+		userID := int64(10000 + i)
+		if _, err := db.Exec(`INSERT INTO User (id, role, language, name, created_at) VALUES (?, 'student', 'ru', ?, 0);
+			INSERT INTO ClassroomMember (classroom_id, user_id, joined_at) VALUES (1, ?, ?)`,
+			userID, fmt.Sprintf("Ученик с очень длинным именем и фамилией №%d", i+1), userID, time.Now().Unix()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+	sentBefore := len(c.m.sent)
+	teacher.send("/class progress 1")
+	parts := c.m.sent[sentBefore:]
+	var students int
+	for _, part := range parts {
+		students += strings.Count(part.Text, " — выполнено ")
+	}
+	if len(parts) < 2 || !strings.HasPrefix(parts[0].Text, "📊 Класс «7А», учеников: 121") || students != 121 {
+		t.Fatalf("прогресс большого класса: сообщений %d, учеников в них %d", len(parts), students)
+	}
+	for _, part := range parts {
+		if n := utf8.RuneCountInString(part.Text); n > maxMessageRunes {
+			t.Errorf("сообщение длиной %d символов", n)
+		}
+	}
+
+	c.send("/start")
+	if got := buttonLabels(c.m.lastSent(t)); strings.Join(got, ",") != "Комбинаторика,Аудирование,📝 Задания (0)" {
+		t.Errorf("меню после выполнения: %v", got)
+	}
+}
+
+// sheetRows читает листы отправленного отчёта
+func sheetRows(t *testing.T, doc fakeDocument) map[string][][]string {
+	t.Helper()
+	book, err := excelize.OpenReader(bytes.NewReader(doc.Bytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheets := make(map[string][][]string)
+	for _, name := range book.GetSheetList() {
+		rows, err := book.GetRows(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sheets[name] = rows
+	}
+	return sheets
+}
+
+func TestTeacherReports(t *testing.T) {
+	c := newTestChat(t)
+	teacher := c.second(2002, "Учитель")
+	setUserRole(teacher.chatID, RoleTeacher)
+	db := openDB()
+	if _, err := db.Exec(`UPDATE Exercise SET answer_mode = 'words' WHERE id = 1`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// две подсказки: «почти» и замена татарской буквы
+	c.openExercise("level1")
+	for _, answer := range []string{"сез", "бетерәсес", "бетерэсез", "Без", "бетерербез"} {
+		c.send(answer)
+	}
+	// учитель видит в отчёте по упражнению только учеников своих классов
+	teacher.send("/report exercise 1")
+	if got := c.m.lastSent(t).Text; len(c.m.documents) != 0 || got != "Ученики ваших классов в этом упражнении ещё не отвечали" {
+		t.Fatalf("отчёт с чужими учениками: %q", got)
+	}
+	teacher.send("/class new 7А/Б")
+	code := regexp.MustCompile(`/join (\w+)`).FindStringSubmatch(c.m.lastSent(t).Text)
+	c.send("/join " + code[1])
+
+	teacher.send("/report exercise 1")
+	if len(c.m.documents) != 1 || c.m.documents[0].Name != "Отчёт — level1.xlsx" || c.m.documents[0].ChatID != teacher.chatID {
+		t.Fatalf("отчёт по упражнению: %+v", c.m.documents)
+	}
+	sheets := sheetRows(t, c.m.documents[0])
+	want := map[string][]string{
+		"Выполнение":    {"Тест", "level1", "1", "1", "да"},
+		"Точность":      {"Тест", "level1", "5", "4", "80"},
+		"Подсказки":     {"Тест", "level1", "5", "2"},
+		"Частые ошибки": nil,
+	}
+	for name, row := range want {
+		rows, ok := sheets[name]
+		switch {
+		case !ok:
+			t.Errorf("нет листа %q", name)
+		case row == nil && len(rows) != 1:
+			t.Errorf("лист %q: %v", name, rows)
+		case row != nil && (len(rows) != 2 || strings.Join(rows[1], "|") != strings.Join(row, "|")):
+			t.Errorf("лист %q: %v, ожидалось %v", name, rows, row)
+		}
+	}
+	if _, ok := sheets["Время"]; !ok {
+		t.Error("нет листа «Время»")
+	}
+
+	teacher.send("/class assign 1 exercise 2")
+	c.send("/start")
+	menu := c.m.lastSent(t)
+	c.press(menu, "📝 Задания (1)")
+	c.press(menu, "⏳ level2")
+	c.press(menu, "▶ Начать")
+	c.answerAll(c.m.lastSent(t), "Син", "Мин", "укы", "ым")
+
+	teacher.send("/report class 1")
+	if len(c.m.documents) != 2 {
+		t.Fatalf("отчёт по классу не отправлен: %q", c.m.lastSent(t).Text)
+	}
+	if name := c.m.documents[1].Name; name != "Отчёт — 7А_Б.xlsx" {
+		t.Errorf("имя файла с «/» в названии класса: %q", name)
+	}
+	mistakes := sheetRows(t, c.m.documents[1])["Частые ошибки"]
+	if len(mistakes) != 2 || strings.Join(mistakes[1], "|") != "level2|я читаю|Мин|Син|1" {
+		t.Errorf("частые ошибки класса: %v", mistakes)
+	}
+
+	setUserRole(3003, RoleTeacher)
+	other := c.second(3003, "Другой")
+	other.send("/report class 1")
+	if got := c.m.lastSent(t).Text; got != "Это не ваш класс" {
+		t.Errorf("чужой класс: %q", got)
+	}
+	other.send("/report exercise 1")
+	if len(c.m.documents) != 2 {
+		t.Errorf("учитель получил учеников чужого класса: %+v", c.m.documents[2:])
+	}
+	// администратору доступны все ученики
+	setUserRole(other.chatID, RoleAdmin)
+	other.send("/report exercise 1")
+	if len(c.m.documents) != 3 || len(sheetRows(t, c.m.documents[2])["Выполнение"]) != 2 {
+		t.Errorf("отчёт администратора по упражнению: %+v", c.m.documents)
+	}
+}
+
+func TestDistractorAnalytics(t *testing.T) {
+	c := newTestChat(t)
+	// четверо сначала ошибаются в «Мин», пятый отвечает верно
+	for i := int64(0); i < 5; i++ {
+		learner := c.second(2001+i, fmt.Sprintf("Ученик %d", i+1))
+		msg := learner.openExercise("level2")
+		if i < 4 {
+			learner.press(msg, "Син")
+		}
+		learner.answerAll(msg, "Мин", "укы", "ым")
+	}
+
+	c.send("/distractors 2")
+	if got := c.m.lastSent(t).Text; strings.HasPrefix(got, "🔎") {
+		t.Fatalf("не админ получил анализ: %q", got)
+	}
+
+	setUserRole(c.chatID, RoleAdmin)
+	c.send("/distractors 2")
+	got := c.m.lastSent(t).Text
+	for _, want := range []string{
+		"я читаю → Мин\n  первых ответов: 5, неверных 80% ❗ почти все ошибаются\n  Син — 4 из 9 (44%)",
+		"я читаю → укы\n  первых ответов: 5, неверных 0%\n  яз — 0 из 5 (0%)\n  ⚠️ никто не выбирает: яз",
+		"⚠️ никто не выбирает: ыйм",
+		"Итого: слишком трудных подвопросов — 1, невыбираемых вариантов — 2",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("в анализе нет %q:\n%s", want, got)
+		}
+	}
+
+	c.send("/distractors 99")
+	if got := c.m.lastSent(t).Text; got != "Упражнение не найдено" {
+		t.Errorf("несуществующее упражнение: %q", got)
+	}
+}
+
+func TestRecommendedExercise(t *testing.T) {
+	c := newTestChat(t)
+	c.send("/recommend")
+	if got := c.m.lastSent(t).Text; !strings.HasPrefix(got, "Рекомендаций пока нет") {
+		t.Errorf("рекомендация новичку: %q", got)
+	}
+
+	// одна ошибка из четырёх ответов: 75% — продолжать по порядку
+	msg := c.openExercise("level2")
+	c.answerAll(msg, "Син", "Мин", "укы", "ым")
+	if got := buttonLabels(msg); len(got) == 0 || got[0] != "⭐ Рекомендуем: level1" {
+		t.Errorf("список после упражнения: %v", got)
+	}
+
+	teacher := c.second(2002, "Учитель")
+	setUserRole(teacher.chatID, RoleTeacher)
+	teacher.send(fmt.Sprintf("/recommend %d", c.chatID))
+	got := c.m.lastSent(t).Text
+	for _, want := range []string{
+		"⭐ Рекомендуем «level1» (id 1)\nПочему: Точность последних попыток 75% — продолжайте по порядку",
+		"Точность последних 5 попыток: 75% (3 из 4)",
+		"Пройдено упражнений: 1 из 2",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("в объяснении нет %q:\n%s", want, got)
+		}
+	}
+
+	c.send(fmt.Sprintf("/recommend %d", teacher.chatID))
+	if got := c.m.lastSent(t).Text; got != "Рекомендации других учеников доступны учителю" {
+		t.Errorf("ученик смотрит чужие рекомендации: %q", got)
+	}
+}
+
+func TestPoolDrawsUnseenQuestionsFirst(t *testing.T) {
+	c := newTestChat(t)
+	db := openDB()
+	if _, err := db.Exec(`UPDATE Exercise SET question_count = 1 WHERE id = 1`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	answers := map[string][]string{
+		"вы заканчиваете": {"Сез", "бетер", "ә", "сез"},
+		"мы закончим":     {"Без", "бетер", "ер", "без"},
+	}
+	seen := map[string]bool{}
+	for attempt, label := range []string{"level1", "✅ level1"} {
+		msg := c.openExercise(label)
+		question := ""
+		for text := range answers {
+			if strings.Contains(msg.Text, text) {
+				question = text
+			}
+		}
+		if question == "" {
+			t.Fatalf("неизвестный вопрос: %q", msg.Text)
+		}
+		if seen[question] {
+			t.Fatalf("попытка %d повторила уже виденный вопрос %q", attempt+1, question)
+		}
+		seen[question] = true
+
+		c.answerAll(msg, answers[question]...)
+		if !strings.HasPrefix(msg.Text, "Упражнение закончено ✅") {
+			t.Fatalf("из пула ожидался один вопрос за попытку, получено %q", msg.Text)
+		}
+	}
+}
+
+func TestWrongAnswerMarksButton(t *testing.T) {
+	c := newTestChat(t)
+	msg := c.openExercise("level2")
+	before := msg.Text
+
+	c.press(msg, "Син")
+	if msg.Text != before {
+		t.Errorf("неверный ответ не должен менять текст: %q", msg.Text)
+	}
+	marked := false
+	for _, button := range msg.buttons() {
+		if button.Text == "❌ Син" {
+			marked = true
+		}
+	}
+	if !marked {
+		t.Error("неверный вариант не отмечен ❌")
+	}
+
+	c.answerAll(msg, "Мин", "укы", "ым")
+	if !strings.HasPrefix(msg.Text, "Упражнение закончено ✅") {
+		t.Errorf("финальное сообщение: %q", msg.Text)
+	}
+}
+
+func TestDuplicateUpdateIsHandledOnce(t *testing.T) {
+	c := newTestChat(t)
+	update := tgbotapi.Update{
+		UpdateID: 42,
+		Message: &tgbotapi.Message{
+			MessageID: 1,
+			From:      c.user(),
+			Chat:      &tgbotapi.Chat{ID: c.chatID, Type: "private"},
+			Text:      "привет",
+		},
+	}
+	processUpdate(c.m, update)
+	processUpdate(c.m, update)
+
+	if len(c.m.sent) != 1 {
+		t.Errorf("повторная доставка обработана %d раз", len(c.m.sent))
+	}
+	if got := loadUpdateOffset(); got != 43 {
+		t.Errorf("offset после обновления 42: %d", got)
+	}
+
+	// запоздалое старое обновление не откатывает offset
+	update.UpdateID = 40
+	processUpdate(c.m, update)
+	if got := loadUpdateOffset(); got != 43 {
+		t.Errorf("offset откатился до %d", got)
+	}
+}
+
+func TestHelpIsStableAndRoleAware(t *testing.T) {
+	c := newTestChat(t)
+	c.send("/help")
+	want := "Доступные команды:\n/start - Запустить бота и выбрать раздел\n/help - Помощь по командам\n"
+	got := c.m.lastSent(t).Text
+	if !strings.HasPrefix(got, want) || strings.Contains(got, "/setrole") {
+		t.Errorf("справка ученика:\n%q", got)
+	}
+	for i := 0; i < 3; i++ {
+		c.send("/help")
+		if again := c.m.lastSent(t).Text; again != got {
+			t.Fatalf("порядок справки меняется:\n%q\n%q", got, again)
+		}
+	}
+
+	setUserRole(c.chatID, RoleAdmin)
+	c.send("/help")
+	if got := c.m.lastSent(t).Text; !strings.Contains(got, "\n/setrole - Назначить роль пользователю: /setrole <id> <student|teacher|admin>\n") {
+		t.Errorf("справка администратора: %q", got)
+	}
+}
+
+func TestAdminCommandRequiresRole(t *testing.T) {
+	c := newTestChat(t)
+	c.send("/setrole 2002 teacher")
+	if got := c.m.lastSent(t).Text; !strings.Contains(got, "недоступна") {
+		t.Errorf("ученик смог вызвать /setrole: %q", got)
+	}
+	if userRole(2002) != RoleStudent {
+		t.Error("роль изменилась без прав администратора")
+	}
+
+	setUserRole(c.chatID, RoleAdmin)
+	c.send("/setrole 2002 teacher")
+	if userRole(2002) != RoleTeacher {
+		t.Errorf("роль после /setrole: %v", userRole(2002))
+	}
+	if menu := c.m.menus["chat:2002"]; len(menu) != len(commands.Available(RoleTeacher)) {
+		t.Errorf("меню учителя: %v", menu)
+	}
+}
+
+func TestCommandMenuIsScopedPerRole(t *testing.T) {
+	c := newTestChat(t)
+	setUserRole(3003, RoleAdmin)
+	syncCommandMenu(c.m)
+
+	var names []string
+	for _, cmd := range c.m.menus["default"] {
+		names = append(names, cmd.Command)
+	}
+	if !strings.HasPrefix(strings.Join(names, ","), "start,help,") || strings.Contains(strings.Join(names, ","), "setrole") {
+		t.Errorf("общее меню: %v", names)
+	}
+	if menu := c.m.menus["chat:3003"]; len(menu) < 3 || menu[2].Command != "setrole" {
+		t.Errorf("меню администратора: %v", menu)
+	}
+}
+
+func TestHelpInTatar(t *testing.T) {
+	c := newTestChat(t)
+	msg := &tgbotapi.Message{
+		From: &tgbotapi.User{ID: c.chatID, LanguageCode: "tt"},
+		Chat: &tgbotapi.Chat{ID: c.chatID},
+	}
+	handleHelpCommand(c.m, msg)
+	if got := c.m.lastSent(t).Text; !strings.HasPrefix(got, "Кулланып була торган командалар:") {
+		t.Errorf("справка на татарском: %q", got)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"database/sql"
+	"html"
+	"log"
+	"strings"
+)
+
+// Тип упражнения (Exercise.type) задаёт, как вопрос показывается ученику
+// и какой вариант верен. Данные у всех типов одни: Question → SubQuestion →
+// Option, подвопросы идут по seq_num; по умолчанию ответ верен, если текст
+// варианта совпадает с текстом подвопроса. Раскладку листа Excel для каждого
+// типа описывает ExcelParser.
+
+// Типы упражнений
+const (
+	TypeSentence = ""       // сборка перевода из частей
+	TypeOrder    = "order"  // части предложения по порядку
+	TypeMatch    = "match"  // сопоставление пар: prompt подвопроса → его текст
+	TypeCloze    = "cloze"  // пропуски в предложении; pointing-строки — видимый текст
+	TypeChoice   = "choice" // один вопрос — один ответ из вариантов
+)
+
+// exerciseType — обработчик типа упражнения
+type exerciseType struct {
+	Practice string                                    // режим практики при запуске
+	Render   func(item Item, done bool) string         // текст вопроса; nil — сборка перевода
+	Options  func(item Item) []answerOption            // варианты на кнопках; nil — все варианты подвопроса
+	Check    func(item Item, option answerOption) bool // верен ли вариант; nil — текст совпадает с подвопросом
+	Extras   bool                                      // доступны ввод текстом, «порядок слов» и обратное направление
+}
+
+// реестр типов упражнений
+var exerciseTypes = map[string]exerciseType{
+	TypeSentence: {Practice: PracticeSentence, Extras: true},
+	TypeOrder:    {Practice: PracticeOrder},
+	TypeMatch:    {Practice: PracticeSentence, Render: matchText, Options: matchOptions, Check: matchCheck},
+	TypeCloze:    {Practice: PracticeSentence, Render: clozeText},
+	TypeChoice:   {Practice: PracticeSentence, Render: choiceText},
+}
+
+// обработчик типа; неизвестный тип показывается как сборка перевода
+// (о таких упражнениях сообщает validateExerciseTypes при запуске)
+func exerciseTypeOf(name string) exerciseType {
+	if t, ok := exerciseTypes[name]; ok {
+		return t
+	}
+	return exerciseTypes[TypeSentence]
+}
+
+// верен ли выбранный вариант подвопроса item
+func (t exerciseType) check(item Item, option answerOption) bool {
+	if t.Check != nil {
+		return t.Check(item, option)
+	}
+	return option.Text == item.Answer
+}
+
+// сообщить в лог об упражнениях неизвестных типов — один раз на тип
+func validateExerciseTypes(db *sql.DB) {
+	rows, err := db.Query(`SELECT type, COUNT(*) FROM Exercise GROUP BY type ORDER BY type`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var count int
+		if err := rows.Scan(&name, &count); err != nil {
+			log.Fatal(err)
+		}
+		if _, ok := exerciseTypes[name]; !ok {
+			log.Printf("Неизвестный тип упражнения %q (упражнений: %d), используется сборка перевода", name, count)
+		}
+	}
+}
+
+// тип упражнения из базы
+func exerciseTypeName(exerciseID int64) string {
+	db := openDB()
+	defer db.Close()
+
+	var name string
+	err := db.QueryRow(`SELECT type FROM Exercise WHERE id = ?`, exerciseID).Scan(&name)
+	if err != nil && err != sql.ErrNoRows {
+		log.Fatal(err)
+	}
+	return name
+}
+
+// индекс подвопроса, на который сейчас отвечают; len(Parts) — вопрос собран
+func (item Item) partIndex(done bool) int {
+	if done {
+		return len(item.Parts)
+	}
+	for i, part := range item.Parts {
+		if part.ID == item.AnswerID {
+			return i
+		}
+	}
+	return len(item.Parts)
+}
+
+// начало сообщения: строка прогресса без номера слова
+func typeHeader(item Item, done bool) string {
+	item.Words = 0
+	if progress := questionProgress(item, done); progress != "" {
+		return progress + "\n"
+	}
+	return ""
+}
+
+// вопрос с выбором одного ответа
+func choiceText(item Item, done bool) string {
+	text := typeHeader(item, done) + "<b>" + html.EscapeString(item.Question) + "</b>"
+	if done {
+		text += "\nОтвет: <b>" + html.EscapeString(item.Script.tatar(item.Answer)) + "</b> ✅"
+	}
+	return text
+}
+
+// предложение с пропусками: заполненные пропуски показываются, остальные — «___»
+func clozeText(item Item, done bool) string {
+	var text strings.Builder
+	text.WriteString(typeHeader(item, done) + "Заполните пропуски:")
+	if item.Question != "" {
+		text.WriteString("\n<i>" + html.EscapeString(item.Question) + "</i>")
+	}
+	current := item.partIndex(done)
+	var sentence strings.Builder
+	for i, part := range item.Parts {
+		switch {
+		case part.Pointing || i < current:
+			sentence.WriteString(part.Text)
+		case i == current:
+			sentence.WriteString("👉___")
+		default:
+			sentence.WriteString("___")
+		}
+	}
+	text.WriteString("\n<b>" + html.EscapeString(item.Script.tatar(sentence.String())) + "</b>")
+	if done {
+		text.WriteString(" ✅")
+	}
+	return text.String()
+}
+
+// сопоставление пар: найденные пары с ответом, текущая отмечена 👉
+func matchText(item Item, done bool) string {
+	var text strings.Builder
+	text.WriteString(typeHeader(item, done) + html.EscapeString(item.Question))
+	current := item.partIndex(done)
+	for i, part := range item.Parts {
+		if part.Pointing {
+			continue
+		}
+		prompt := html.EscapeString(part.Prompt)
+		switch {
+		case i < current:
+			text.WriteString("\n" + prompt + " — <b>" + html.EscapeString(item.Script.tatar(part.Text)) + "</b> ✅")
+		case i == current:
+			text.WriteString("\n👉 " + prompt + " — ?")
+		default:
+			text.WriteString("\n" + prompt + " — ?")
+		}
+	}
+	return text.String()
+}
+
+// у каждой пары свой вариант: k-й вариант подвопроса — правая часть k-й пары
+// (так их записывает ExcelParser)
+func (item Item) pairedOptions() bool {
+	return item.Word >= 1 && len(item.Options) == item.Words
+}
+
+// пара сопоставлена верно, если выбран её собственный вариант: пары
+// с одинаковой правой частью не принимают варианты друг друга
+func matchCheck(item Item, option answerOption) bool {
+	if !item.pairedOptions() {
+		return option.Text == item.Answer
+	}
+	return option.ID == item.Options[item.Word-1].ID
+}
+
+// варианты всех пар: найденные не убираются, иначе последнюю пару выдаёт
+// единственная кнопка. Одинаковые правые части показываются одной кнопкой —
+// вариантом текущей пары
+func matchOptions(item Item) []answerOption {
+	if !item.pairedOptions() {
+		return item.Options
+	}
+	own := item.Options[item.Word-1]
+	shown := make(map[string]bool)
+	var options []answerOption
+	for _, option := range item.Options {
+		if option.Text == own.Text {
+			option = own
+		}
+		if !shown[option.Text] {
+			shown[option.Text] = true
+			options = append(options, option)
+		}
+	}
+	return options
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchPairsWithSameAnswer(t *testing.T) {
+	// две пары с одинаковой правой частью «зур»
+	parts := []subQuestionRow{{ID: 1, Prompt: "большой", Text: "зур"}, {ID: 2, Prompt: "крупный", Text: "зур"}, {ID: 3, Prompt: "маленький", Text: "кечкенә"}}
+	options := []answerOption{{11, "зур"}, {12, "зур"}, {13, "кечкенә"}}
+	item := func(current int) Item {
+		return Item{Type: TypeMatch, Parts: parts, AnswerID: parts[current].ID, Answer: parts[current].Text,
+			Word: current + 1, Words: len(parts), Options: options}
+	}
+	match := exerciseTypeOf(TypeMatch)
+
+	first, second := item(0), item(1)
+	if !match.check(first, options[0]) || match.check(first, options[1]) {
+		t.Error("первая пара должна принимать только свой вариант")
+	}
+	if match.check(second, options[0]) || !match.check(second, options[1]) {
+		t.Error("вторая пара должна принимать только свой вариант")
+	}
+
+	labels := func(item Item) string {
+		var texts []string
+		for _, option := range match.Options(item) {
+			texts = append(texts, option.Text)
+		}
+		return strings.Join(texts, ",")
+	}
+	if got := labels(first); got != "зур,кечкенә" {
+		t.Errorf("кнопки первой пары: %s", got)
+	}
+	if got := match.Options(second); len(got) != 2 || got[0].ID != 12 {
+		t.Errorf("кнопки второй пары: %v", got)
+	}
+	// у последней пары выбор тот же, а не одна оставшаяся кнопка
+	if got := labels(item(2)); got != "зур,кечкенә" {
+		t.Errorf("кнопки последней пары: %s", got)
+	}
+
+	// остальные типы сравнивают текст варианта с текстом подвопроса
+	sentence := exerciseTypeOf(TypeSentence)
+	if !sentence.check(first, options[1]) || sentence.check(first, options[2]) {
+		t.Error("проверка по тексту")
+	}
+}
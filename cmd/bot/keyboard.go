@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// keyboardLayout раскладывает кнопки по строкам: число колонок зависит от
+// ширины самой длинной подписи, строки заполняются равномерно, пустых строк нет
+type keyboardLayout struct {
+	MaxColumns int // не больше стольких кнопок в строке
+	RowWidth   int // сколько символов подписей помещается в строку
+}
+
+// раскладка кнопок вариантов ответа
+var optionsLayout = keyboardLayout{MaxColumns: 4, RowWidth: 24}
+
+// ширина кнопки: подпись и поля по краям
+const buttonPadding = 2
+
+// число колонок для кнопок
+func (l keyboardLayout) columns(buttons []tgbotapi.InlineKeyboardButton) int {
+	widest := 0
+	for _, button := range buttons {
+		widest = max(widest, utf8.RuneCountInString(button.Text)+buttonPadding)
+	}
+	columns := 1
+	if widest > 0 {
+		columns = l.RowWidth / widest
+	}
+	return max(1, min(columns, l.MaxColumns, len(buttons)))
+}
+
+// разложить кнопки по строкам
+func (l keyboardLayout) rows(buttons []tgbotapi.InlineKeyboardButton) [][]tgbotapi.InlineKeyboardButton {
+	if len(buttons) == 0 {
+		return nil
+	}
+	columns := l.columns(buttons)
+	// выравниваем строки: 4 кнопки в 3 колонки — это 2 + 2, а не 3 + 1
+	rowCount := (len(buttons) + columns - 1) / columns
+	columns = (len(buttons) + rowCount - 1) / rowCount
+
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	for start := 0; start < len(buttons); start += columns {
+		end := min(start+columns, len(buttons))
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(buttons[start:end]...))
+	}
+	return keyboard
+}
+
+// клавиатура вариантов ответа; вариант wrongID отмечается ❌ (0 — без отметки).
+// Варианты перемешаны: ExcelParser записывает верный вариант первым. Порядок
+// зависит только от nonce, поэтому не меняется при перерисовке сообщения
+func optionKeyboard(item Item, nonce uint32, wrongID int64) *tgbotapi.InlineKeyboardMarkup {
+	script := item.optionScript()
+	options := item.Options
+	if filter := exerciseTypeOf(item.Type).Options; filter != nil {
+		options = filter(item)
+	}
+	options = append([]answerOption(nil), options...)
+	sort.SliceStable(options, func(i, j int) bool {
+		return shuffleKey(nonce, options[i].ID) < shuffleKey(nonce, options[j].ID)
+	})
+	var buttons []tgbotapi.InlineKeyboardButton
+	for _, option := range options {
+		label := script.tatar(option.Text)
+		if option.ID == wrongID {
+			label = fmt.Sprintf("❌ %s", label)
+		}
+		buttons = append(buttons, callbackButton(label, ActionAnswer, nonce, option.ID))
+	}
+	markup := tgbotapi.NewInlineKeyboardMarkup(optionsLayout.rows(buttons)...)
+	return &markup
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func rowSizes(keyboard [][]tgbotapi.InlineKeyboardButton) []int {
+	var sizes []int
+	for _, row := range keyboard {
+		sizes = append(sizes, len(row))
+	}
+	return sizes
+}
+
+func TestKeyboardLayout(t *testing.T) {
+	labels := func(texts ...string) []tgbotapi.InlineKeyboardButton {
+		var buttons []tgbotapi.InlineKeyboardButton
+		for _, text := range texts {
+			buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(text, text))
+		}
+		return buttons
+	}
+	layout := keyboardLayout{MaxColumns: 4, RowWidth: 24}
+	tests := []struct {
+		name    string
+		layout  keyboardLayout
+		buttons []tgbotapi.InlineKeyboardButton
+		want    []int
+	}{
+		{"короткие аффиксы", layout, labels("ә", "а", "и"), []int{3}},
+		{"ровно по колонкам без пустой строки", layout, labels("Мин", "Сез", "Без", "Син"), []int{4}},
+		{"строки выравниваются", layout, labels("башла", "бетер", "уйла", "укы", "яз"), []int{3, 2}},
+		{"длинные варианты по одному", layout, labels("бетерәсезме икән", "башлыйсызмы икән"), []int{1, 1}},
+		{"ограничение колонок", keyboardLayout{MaxColumns: 2, RowWidth: 24}, labels("а", "ә", "и", "ы"), []int{2, 2}},
+		{"нет кнопок", layout, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rowSizes(tt.layout.rows(tt.buttons))
+			if len(got) != len(tt.want) {
+				t.Fatalf("строки %v, ожидалось %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("строки %v, ожидалось %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestOptionKeyboardKeepsOrder(t *testing.T) {
+	item := Item{Options: []answerOption{{1, "Сез"}, {2, "Без"}, {3, "Мин"}, {4, "Син"}, {5, "Алар"}}}
+	labels := func(nonce uint32) string {
+		var labels []string
+		for _, row := range optionKeyboard(item, nonce, 2).InlineKeyboard {
+			for _, button := range row {
+				labels = append(labels, button.Text)
+			}
+		}
+		return strings.Join(labels, ",")
+	}
+
+	// с тем же nonce порядок не меняется от отрисовки к отрисовке
+	want := labels(1)
+	for i := 0; i < 20; i++ {
+		if got := labels(1); got != want {
+			t.Fatalf("кнопки %s, в первый раз %s", got, want)
+		}
+	}
+	if !strings.Contains(want, "❌ Без") {
+		t.Errorf("неверный вариант не отмечен: %s", want)
+	}
+
+	// в разных попытках порядок разный, а верный вариант не всегда первый
+	orders := make(map[string]bool)
+	firstRight := 0
+	for nonce := uint32(1); nonce <= 50; nonce++ {
+		got := labels(nonce)
+		orders[got] = true
+		if strings.HasPrefix(got, "Сез,") {
+			firstRight++
+		}
+	}
+	if len(orders) < 2 || firstRight == 50 {
+		t.Errorf("порядок кнопок не зависит от попытки: %d вариантов, «Сез» первым %d раз из 50", len(orders), firstRight)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"log"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Экранные татарские буквы для режима ввода: на многих телефонах их нет
+// в раскладке. Нажатие дописывает букву в набор (ExerciseSession.compose),
+// ⌫ стирает последний символ, «Проверить» отправляет набранное на проверку.
+// Текст, написанный сообщением, дописывается к набору.
+
+// буквы на экранной клавиатуре; в callback data передаётся индекс
+var tatarLetters = map[Script][]string{
+	ScriptCyrillic: {"ә", "ө", "ү", "җ", "ң", "һ"},
+	ScriptLatin:    {"ä", "ö", "ü", "ç", "ğ", "ı", "ñ", "ş"},
+}
+
+// раскладка экранных букв
+var lettersLayout = keyboardLayout{MaxColumns: 6, RowWidth: 24}
+
+// клавиатура с буквами; в режиме sentence есть пробел, ⌫ и «Проверить» — когда есть набор
+func lettersKeyboard(mode string, nonce uint32, composing bool, script Script) *tgbotapi.InlineKeyboardMarkup {
+	var letters []tgbotapi.InlineKeyboardButton
+	for i, letter := range tatarLetters[script] {
+		letters = append(letters, callbackButton(letter, ActionTypedLetter, nonce, int64(i)))
+	}
+	keyboard := lettersLayout.rows(letters)
+
+	var controls []tgbotapi.InlineKeyboardButton
+	if mode == AnswerSentence {
+		controls = append(controls, callbackButton("␣", ActionTypedLetter, nonce, int64(len(tatarLetters[script]))))
+	}
+	if composing {
+		controls = append(controls,
+			callbackButton("⌫", ActionTypedBackspace, nonce),
+			callbackButton("✅ Проверить", ActionTypedSubmit, nonce),
+		)
+	}
+	if len(controls) > 0 {
+		keyboard = append(keyboard, controls)
+	}
+	markup := tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+	return &markup
+}
+
+// символ экранной клавиатуры по индексу; последний после букв — пробел
+func screenLetter(script Script, index int64) (string, bool) {
+	letters := tatarLetters[script]
+	switch {
+	case index >= 0 && index < int64(len(letters)):
+		return letters[index], true
+	case index == int64(len(letters)):
+		return " ", true
+	}
+	return "", false
+}
+
+// обработать кнопку экранной клавиатуры; текст — ответ на нажатие
+func handleTypedButton(m Messenger, query *tgbotapi.CallbackQuery, cb Callback) string {
+	userID := query.From.ID
+	session := loadTypedSession(userID)
+	if session == nil || session.Nonce != cb.Nonce || session.MessageID != query.Message.MessageID {
+		log.Printf("Экранная клавиатура не из текущей сессии пользователя %d", userID)
+		return "Это упражнение уже неактивно. Откройте его заново"
+	}
+
+	compose := session.Compose
+	switch cb.Action {
+	case ActionTypedLetter:
+		letter, ok := screenLetter(session.Script, cb.IDs[0])
+		if !ok {
+			return "Неизвестная буква"
+		}
+		compose += letter
+	case ActionTypedBackspace:
+		if compose == "" {
+			return "Стирать нечего"
+		}
+		_, size := utf8.DecodeLastRuneInString(compose)
+		compose = compose[:len(compose)-size]
+	case ActionTypedSubmit:
+		if compose == "" {
+			return "Сначала наберите ответ"
+		}
+		checkTypedAnswer(m, query.Message.Chat, userID, session, compose, false)
+		return "Обработка выполнена"
+	}
+
+	setCompose(userID, session.Nonce, compose)
+	q := loadTypedQuestion(userID, session)
+	q.show(m, query.Message.Chat.ID, session.MessageID, session.Nonce, compose)
+	return "Обработка выполнена"
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Сколько упражнений помещается на одну страницу списка
+const exercisesPerPage = 8
+
+// статус упражнения для конкретного ученика
+type exerciseStatus int
+
+const (
+	statusNew exerciseStatus = iota
+	statusInProgress
+	statusDone
+)
+
+var statusMarkers = map[exerciseStatus]string{
+	statusNew:        "",
+	statusInProgress: "▶ ",
+	statusDone:       "✅ ",
+}
+
+// exerciseEntry — строка списка упражнений
+type exerciseEntry struct {
+	ID     int64
+	Title  string
+	Level  int
+	Topic  string
+	Group  string
+	Status exerciseStatus
+	Locked bool
+}
+
+// упражнения, упорядоченные по уровню, теме и позиции, со статусами ученика
+func loadExerciseEntries(userID int64) []exerciseEntry {
+	db := openDB()
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT
+			e.id,
+			e.title,
+			e.level,
+			e.topic,
+			EXISTS (
+				SELECT 1 FROM ExerciseSession s
+				WHERE s.user_id = ? AND s.exercise_id = e.id AND s.finished_at IS NULL
+			) AS in_progress,
+			EXISTS (
+				SELECT 1 FROM ExerciseResult r
+				WHERE r.user_id = ? AND r.exercise_id = e.id
+			) AS done
+		FROM Exercise e
+		ORDER BY e.level = 0, e.level, e.topic, e.position, e.id`, userID, userID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+
+	var entries []exerciseEntry
+	for rows.Next() {
+		var entry exerciseEntry
+		var inProgress, done bool
+		if err := rows.Scan(&entry.ID, &entry.Title, &entry.Level, &entry.Topic, &inProgress, &done); err != nil {
+			log.Fatal(err)
+		}
+		entry.Group = exerciseGroup(entry.Level, entry.Topic)
+		switch {
+		case inProgress:
+			entry.Status = statusInProgress
+		case done:
+			entry.Status = statusDone
+		}
+		entries = append(entries, entry)
+	}
+	rows.Close()
+
+	if userRole(userID) < RoleTeacher {
+		locked := lockedExercises(db, userID)
+		for i := range entries {
+			entries[i].Locked = locked[entries[i].ID]
+		}
+	}
+	return entries
+}
+
+// названия групп в порядке первого появления
+func exerciseGroups(entries []exerciseEntry) []string {
+	var groups []string
+	for _, entry := range entries {
+		if len(groups) == 0 || groups[len(groups)-1] != entry.Group {
+			groups = append(groups, entry.Group)
+		}
+	}
+	return groups
+}
+
+// группа упражнения в списке: уровень и тема
+func exerciseGroup(level int, topic string) string {
+	switch {
+	case level > 0 && topic != "":
+		return fmt.Sprintf("Уровень %d · %s", level, topic)
+	case level > 0:
+		return fmt.Sprintf("Уровень %d", level)
+	default:
+		return topic
+	}
+}
+
+// подпись группы в списке
+func groupTitle(group string) string {
+	if group == "" {
+		return "Без уровня"
+	}
+	return group
+}
+
+// LevelsList показывает список упражнений, редактируя сообщение messageID
+// (0 — отправить новое). group: 0 — все упражнения или выбор группы,
+// если групп несколько; n — n-я группа. header выводится над списком.
+func LevelsList(m Messenger, chatID int64, messageID int, userID int64, group int, page int, header string) {
+	entries := loadExerciseEntries(userID)
+	groups := exerciseGroups(entries)
+
+	var text strings.Builder
+	if header != "" {
+		text.WriteString(header + "\n\n")
+	}
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+
+	switch {
+	case len(entries) == 0:
+		text.WriteString("Упражнений пока нет")
+	case len(groups) > 1 && (group <= 0 || group > len(groups)):
+		// несколько групп: сначала выбираем уровень или тему
+		if entries[0].Level > 0 {
+			text.WriteString("Выберите уровень")
+		} else {
+			text.WriteString("Выберите тему")
+		}
+		for i, name := range groups {
+			done, total := 0, 0
+			for _, entry := range entries {
+				if entry.Group == name {
+					total++
+					if entry.Status == statusDone {
+						done++
+					}
+				}
+			}
+			label := fmt.Sprintf("%s (%d/%d ✅)", groupTitle(name), done, total)
+			keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+				callbackButton(label, ActionExerciseList, 0, int64(i+1), 0),
+			))
+		}
+	default:
+		selected := entries
+		if len(groups) > 1 {
+			selected = nil
+			for _, entry := range entries {
+				if entry.Group == groups[group-1] {
+					selected = append(selected, entry)
+				}
+			}
+		}
+
+		pages := (len(selected) + exercisesPerPage - 1) / exercisesPerPage
+		if page < 0 {
+			page = 0
+		}
+		if page >= pages {
+			page = pages - 1
+		}
+
+		text.WriteString("Выберите упражнение")
+		if len(groups) > 1 {
+			text.WriteString("\n" + groupTitle(groups[group-1]))
+		}
+		if pages > 1 {
+			text.WriteString(fmt.Sprintf("\nСтраница %d из %d", page+1, pages))
+		}
+
+		start := page * exercisesPerPage
+		end := min(start+exercisesPerPage, len(selected))
+		for _, entry := range selected[start:end] {
+			marker := statusMarkers[entry.Status]
+			if entry.Locked {
+				marker = "🔒 "
+			}
+			keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+				callbackButton(marker+entry.Title, ActionExercise, 0, entry.ID),
+			))
+		}
+
+		var nav []tgbotapi.InlineKeyboardButton
+		if page > 0 {
+			nav = append(nav, callbackButton("⬅️ Назад", ActionExerciseList, 0, int64(max(group, 0)), int64(page-1)))
+		}
+		if page < pages-1 {
+			nav = append(nav, callbackButton("Вперёд ➡️", ActionExerciseList, 0, int64(max(group, 0)), int64(page+1)))
+		}
+		if len(nav) > 0 {
+			keyboard = append(keyboard, nav)
+		}
+		if len(groups) > 1 {
+			keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+				callbackButton("⬆️ К темам", ActionExerciseList, 0, 0, 0),
+			))
+		}
+	}
+
+	// на первом экране списка — рекомендованное упражнение
+	if group <= 0 && page == 0 && len(entries) > 0 {
+		if rec, ok := recommendExercise(userID, entries); ok {
+			keyboard = append([][]tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardRow(
+				callbackButton("⭐ Рекомендуем: "+rec.Title, ActionExercise, 0, rec.ExerciseID),
+			)}, keyboard...)
+		}
+	}
+
+	if len(loadCourseIDs()) > 0 {
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(callbackButton("📚 Курсы", ActionCourseList, 0)))
+	}
+	showScreen(m, chatID, messageID, text.String(), keyboard)
+}
+
+// ExerciseCard показывает карточку упражнения перед стартом: описание
+// и кнопки режимов практики
+func ExerciseCard(m Messenger, msg *tgbotapi.Message, userID int64, exerciseID int64) {
+	db := openDB()
+	defer db.Close()
+
+	var title, description, typeName string
+	var level int
+	err := db.QueryRow(`SELECT title, level, description, type FROM Exercise WHERE id = ?`, exerciseID).
+		Scan(&title, &level, &description, &typeName)
+	if err != nil {
+		log.Printf("Упражнение %d не найдено: %v", exerciseID, err)
+		return
+	}
+	text := title
+	if level > 0 {
+		text += fmt.Sprintf(" (уровень %d)", level)
+	}
+	if strings.TrimSpace(description) != "" {
+		text += "\n\n" + description
+	}
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(callbackButton("▶ Начать", ActionStartExercise, 0, exerciseID)),
+	}
+	if exerciseTypeOf(typeName).Extras {
+		if exerciseHasReverse(exerciseID) {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(callbackButton("🔄 С татарского на русский", ActionStartReverse, 0, exerciseID)))
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(callbackButton("🔀 Порядок слов", ActionStartOrder, 0, exerciseID)))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(callbackButton("⬅️ К списку", ActionExerciseList, 0, 0, 0)))
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	if err := m.EditMessage(msg.Chat.ID, msg.MessageID, text, &markup); err != nil {
+		log.Printf("Ошибка показа описания упражнения: %v", err)
+	}
+}
@@ -5,29 +5,183 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	_ "modernc.org/sqlite"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-// Команды бота и их описания
-var commands = map[string]string{
-	"start": "Запустить бота",
-	"help":  "Помощь по командам",
+// Команды бота в порядке, в котором они показываются в /help и меню Telegram
+var commands = newCommandRouter()
+
+func init() {
+	commands.Register(Command{
+		Name:        "start",
+		Description: "Запустить бота",
+		Role:        RoleStudent,
+		Help: map[string]string{
+			"ru": "Запустить бота и выбрать раздел",
+			"tt": "Ботны җибәрү һәм бүлек сайлау",
+			"en": "Start the bot and choose a section",
+		},
+		Handler: handleStartCommand,
+	})
+	commands.Register(Command{
+		Name:        "help",
+		Description: "Помощь по командам",
+		Role:        RoleStudent,
+		Help: map[string]string{
+			"ru": "Помощь по командам",
+			"tt": "Командалар буенча ярдәм",
+			"en": "Help on commands",
+		},
+		Handler: handleHelpCommand,
+	})
+	commands.Register(Command{
+		Name:        "setrole",
+		Description: "Назначить роль: /setrole <id> <student|teacher|admin>",
+		Role:        RoleAdmin,
+		Help: map[string]string{
+			"ru": "Назначить роль пользователю: /setrole <id> <student|teacher|admin>",
+			"tt": "Кулланучыга роль билгеләү: /setrole <id> <student|teacher|admin>",
+			"en": "Assign a role: /setrole <id> <student|teacher|admin>",
+		},
+		Handler: handleSetRoleCommand,
+	})
+	commands.Register(Command{
+		Name:        "unlock",
+		Description: "Открыть упражнение ученику: /unlock <id> <id упражнения>",
+		Role:        RoleAdmin,
+		Help: map[string]string{
+			"ru": "Открыть закрытое упражнение ученику: /unlock <id пользователя> <id упражнения>",
+			"tt": "Укучыга ябык күнегүне ачу: /unlock <кулланучы id> <күнегү id>",
+			"en": "Unlock an exercise for a learner: /unlock <user id> <exercise id>",
+		},
+		Handler: handleUnlockCommand,
+	})
+	commands.Register(Command{
+		Name:        "continue",
+		Description: "Продолжить текущий курс",
+		Role:        RoleStudent,
+		Help: map[string]string{
+			"ru": "Продолжить текущий курс со следующего упражнения",
+			"tt": "Агымдагы курсны киләсе күнегүдән дәвам итү",
+			"en": "Resume the current course from the next exercise",
+		},
+		Handler: handleContinueCommand,
+	})
+	commands.Register(Command{
+		Name:        "script",
+		Description: "Письменность: кириллица или латиница",
+		Role:        RoleStudent,
+		Help: map[string]string{
+			"ru": "Показывать татарский текст кириллицей или латиницей: /script <cyrillic|latin>",
+			"tt": "Татар текстын кириллицада яки латиницада күрсәтү: /script <cyrillic|latin>",
+			"en": "Show Tatar text in Cyrillic or Latin script: /script <cyrillic|latin>",
+		},
+		Handler: handleScriptCommand,
+	})
+	commands.Register(Command{
+		Name:        "quiz",
+		Description: "Викторина в группе: /quiz <id упражнения> | stop",
+		Role:        RoleTeacher,
+		Help: map[string]string{
+			"ru": "Викторина в групповом чате: /quiz <id упражнения> — опросы по упражнению, /quiz stop — итоги",
+			"tt": "Төркемдә викторина: /quiz <күнегү id> — күнегү буенча сораштырулар, /quiz stop — нәтиҗәләр",
+			"en": "Group quiz: /quiz <exercise id> posts quiz polls, /quiz stop shows the leaderboard",
+		},
+		Handler: handleQuizCommand,
+	})
+	commands.Register(Command{
+		Name:        "duel",
+		Description: "Дуэль: /duel <id упражнения> | join <код> | cancel",
+		Role:        RoleStudent,
+		Help: map[string]string{
+			"ru": "Дуэль с другим учеником на одних и тех же вопросах: /duel <id упражнения> — найти соперника, /duel join <код> — принять приглашение, /duel cancel — выйти",
+			"tt": "Башка укучы белән бер үк сораулар буенча ярыш: /duel <күнегү id> — көндәш табу, /duel join <код> — чакыруны кабул итү, /duel cancel — чыгу",
+			"en": "Race another learner on the same questions: /duel <exercise id> finds an opponent, /duel join <code> accepts an invite, /duel cancel leaves",
+		},
+		Handler: handleDuelCommand,
+	})
+	commands.Register(Command{
+		Name:        "join",
+		Description: "Вступить в класс: /join <код>",
+		Role:        RoleStudent,
+		Help: map[string]string{
+			"ru": "Вступить в класс учителя: /join <код класса>",
+			"tt": "Укытучы сыйныфына керү: /join <сыйныф коды>",
+			"en": "Join a teacher's classroom: /join <class code>",
+		},
+		Handler: handleJoinCommand,
+	})
+	commands.Register(Command{
+		Name:        "class",
+		Description: "Классы: /class new | assign | progress",
+		Role:        RoleTeacher,
+		Help: map[string]string{
+			"ru": "Классы учителя: /class new <название> — создать, /class assign <id класса> <exercise|course> <id> [ДД.ММ.ГГГГ] — выдать задание, /class progress <id класса> — прогресс учеников",
+			"tt": "Укытучы сыйныфлары: /class new <исем> — төзү, /class assign <сыйныф id> <exercise|course> <id> [КК.АА.ЕЕЕЕ] — бирем бирү, /class progress <сыйныф id> — укучылар нәтиҗәсе",
+			"en": "Teacher classrooms: /class new <title> creates one, /class assign <class id> <exercise|course> <id> [DD.MM.YYYY] sets homework, /class progress <class id> shows learner progress",
+		},
+		Handler: handleClassCommand,
+	})
+	commands.Register(Command{
+		Name:        "report",
+		Description: "Отчёт Excel: /report class <id> | exercise <id>",
+		Role:        RoleTeacher,
+		Help: map[string]string{
+			"ru": "Отчёт Excel: /report class <id класса> или /report exercise <id упражнения> — выполнение, точность, время, подсказки и частые ошибки",
+			"tt": "Excel хисабы: /report class <сыйныф id> яки /report exercise <күнегү id> — үтәлеш, төгәллек, вакыт, ярдәмнәр һәм еш хаталар",
+			"en": "Excel report: /report class <class id> or /report exercise <exercise id> with completion, accuracy, time, hints and common mistakes",
+		},
+		Handler: handleReportCommand,
+	})
+	commands.Register(Command{
+		Name:        "distractors",
+		Description: "Анализ вариантов ответов: /distractors <id упражнения>",
+		Role:        RoleAdmin,
+		Help: map[string]string{
+			"ru": "Какие неверные варианты выбирают ученики, какие не выбирает никто и где почти все ошибаются: /distractors <id упражнения>",
+			"tt": "Укучылар нинди ялгыш вариантларны сайлый, кайсыларын беркем дә сайламый һәм кайда барысы да диярлек ялгыша: /distractors <күнегү id>",
+			"en": "Which wrong options learners pick, which nobody picks and where almost everyone fails: /distractors <exercise id>",
+		},
+		Handler: handleDistractorsCommand,
+	})
+	commands.Register(Command{
+		Name:        "recommend",
+		Description: "Почему рекомендовано упражнение",
+		Role:        RoleStudent,
+		Help: map[string]string{
+			"ru": "Какое упражнение рекомендовано и почему; учитель может указать id ученика: /recommend [id пользователя]",
+			"tt": "Нинди күнегү тәкъдим ителгән һәм ни өчен; укытучы укучы id сын күрсәтә ала: /recommend [кулланучы id]",
+			"en": "Which exercise is recommended and why; a teacher may pass a learner id: /recommend [user id]",
+		},
+		Handler: handleRecommendCommand,
+	})
 }
 
+// Путь к базе данных бота; в тестах подменяется на фикстуру
+var dbPath = "bot.db"
+
 type Item struct {
 	Question   string
 	QuestionID int64
 	Answer     string
 	AnswerID   int64
 	SeqNum     int
-	Prepinanie bool
-	Options    map[int64]string
+	Lead       string // поле ответа до первого подвопроса (пунктуация в начале)
+	Word       int    // номер подвопроса среди подвопросов для ответа
+	Words      int
+	Number     int // номер вопроса в попытке
+	Total      int
+	Direction  string // DirectionForward или DirectionReverse
+	Script     Script // письменность татарского текста для ученика
+	Type       string // тип упражнения (Exercise.type)
+	Parts      []subQuestionRow
+	Options    []answerOption
 }
 
 func main() {
@@ -46,626 +200,439 @@ func main() {
 	bot.Debug = true // Включаем логирование (опционально)
 
 	log.Printf("Бот %s запущен", bot.Self.UserName)
+	botUserName = bot.Self.UserName
+
+	m := newTelegramMessenger(bot)
 
-	// Настраиваем канал обновлений
-	u := tgbotapi.NewUpdate(0)
+	db := openDB()
+	ensureSchema(db)
+	validateExerciseTypes(db)
+	db.Close()
+	bootstrapAdmins()
+	syncCommandMenu(m)
+	initCallbackSecret()
+
+	// Настраиваем канал обновлений, продолжая с сохранённого offset
+	u := tgbotapi.NewUpdate(loadUpdateOffset())
 	u.Timeout = 60
 	updates := bot.GetUpdatesChan(u)
 
-	// Обрабатываем входящие обновления
-	for update := range updates {
-		if update.CallbackQuery != nil && update.CallbackQuery.Data != "" {
-			handleCallbackQuery(bot, update.CallbackQuery)
-		}
-		if update.Message == nil {
-			continue // Игнорируем всё, кроме сообщений
+	// Обрабатываем входящие обновления; в том же цикле, чтобы не пересекаться
+	// с обработчиками, раз в timeoutCheckInterval завершаем то, что ждёт по времени
+	ticker := time.NewTicker(timeoutCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+			processUpdate(m, update)
+		case <-ticker.C:
+			expireTimeouts(m)
 		}
+	}
+}
 
-		// Обработка команд
-		switch update.Message.Command() {
-		case "start":
-			handleStartCommand(bot, update.Message)
-		case "help":
-			handleHelpCommand(bot, update.Message)
-		default:
-			handleTextMessage(bot, update.Message)
-		}
+// как часто проверять дуэли и викторины с истёкшим временем
+const timeoutCheckInterval = time.Minute
+
+// завершить дуэли и раунды викторины, время которых вышло
+func expireTimeouts(m Messenger) {
+	expireStaleDuels(m)
+	finishExpiredQuizRounds(m)
+}
+
+// Обработчик одного обновления от Telegram
+func handleUpdate(m Messenger, update tgbotapi.Update) {
+	if update.CallbackQuery != nil && update.CallbackQuery.Data != "" {
+		handleCallbackQuery(m, update.CallbackQuery)
+	}
+	if update.PollAnswer != nil {
+		handlePollAnswer(update.PollAnswer)
+	}
+	if update.Message == nil {
+		return // Игнорируем всё, кроме сообщений
+	}
+	rememberUser(update.Message.From)
+
+	// Обработка команд
+	if !commands.Dispatch(m, update.Message) {
+		handleTextMessage(m, update.Message)
 	}
 }
 
 // Обработчик команды /start
-func handleStartCommand(bot *tgbotapi.BotAPI, msg *tgbotapi.Message) {
+func handleStartCommand(m Messenger, msg *tgbotapi.Message) {
+	// ссылка-приглашение в дуэль: /start duel_<код>
+	if code, ok := strings.CutPrefix(msg.CommandArguments(), duelStartPrefix); ok && msg.Chat.IsPrivate() {
+		joinDuelByCode(m, msg.Chat.ID, msg.From.ID, code)
+		return
+	}
+	// ссылка на класс: /start class_<код>
+	if code, ok := strings.CutPrefix(msg.CommandArguments(), classStartPrefix); ok {
+		sendMessage(m, msg.Chat.ID, joinClassroom(msg.From.ID, code))
+		return
+	}
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Комбинаторика", "Combinatorics"),
-			tgbotapi.NewInlineKeyboardButtonData("Аудирование", "Listening"),
+			callbackButton("Комбинаторика", ActionCombinatorics, 0),
+			callbackButton("Аудирование", ActionListening, 0),
 		),
 	)
+	if pending := pendingAssignments(msg.From.ID); pending >= 0 {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(
+			callbackButton(fmt.Sprintf("📝 Задания (%d)", pending), ActionAssignments, 0),
+		))
+	}
 
-	newMsg := tgbotapi.NewMessage(
-		msg.Chat.ID,
-		"Привет! Я телеграм-бот для практики грамматики татарского языка.\nИспользуй /help для списка команд.",
-	)
-	newMsg.ReplyMarkup = keyboard
-
-	if _, err := bot.Send(newMsg); err != nil {
+	text := "Привет! Я телеграм-бот для практики грамматики татарского языка.\nИспользуй /help для списка команд."
+	if _, err := m.SendMessage(msg.Chat.ID, text, keyboard); err != nil {
 		log.Println("Ошибка отправки /start:", err)
 	}
 
 }
 
 // Обработчик команды /help
-func handleHelpCommand(bot *tgbotapi.BotAPI, msg *tgbotapi.Message) {
-	helpText := "Доступные команды:\n"
-	for cmd, desc := range commands {
-		helpText += "/" + cmd + " - " + desc + "\n"
+func handleHelpCommand(m Messenger, msg *tgbotapi.Message) {
+	language := defaultLanguage
+	if msg.From != nil {
+		language = msg.From.LanguageCode
+	}
+	sendMessage(m, msg.Chat.ID, commands.HelpText(senderRole(msg), language))
+}
+
+// Обработчик команды /setrole <id> <роль>
+func handleSetRoleCommand(m Messenger, msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) != 2 {
+		sendMessage(m, msg.Chat.ID, "Формат: /setrole <id> <student|teacher|admin>")
+		return
+	}
+	userID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		sendMessage(m, msg.Chat.ID, "Некорректный id пользователя")
+		return
+	}
+	role, ok := parseRole(args[1])
+	if !ok {
+		sendMessage(m, msg.Chat.ID, "Неизвестная роль. Доступны: student, teacher, admin")
+		return
 	}
-	sendMessage(bot, msg.Chat.ID, helpText)
+	setUserRole(userID, role)
+	syncUserCommandMenu(m, userID, role)
+	sendMessage(m, msg.Chat.ID, fmt.Sprintf("Пользователю %d назначена роль %s", userID, role))
 }
 
 // Обработчик обычных текстовых сообщений
-func handleTextMessage(bot *tgbotapi.BotAPI, msg *tgbotapi.Message) {
+func handleTextMessage(m Messenger, msg *tgbotapi.Message) {
+	if handleTypedAnswer(m, msg) {
+		return
+	}
 	reply := "Я не понимаю твоего сообщения. Попробуй /help"
-	sendMessage(bot, msg.Chat.ID, reply)
+	sendMessage(m, msg.Chat.ID, reply)
 }
 
 // Утилита для отправки сообщений
-func sendMessage(bot *tgbotapi.BotAPI, chatID int64, text string) {
-	msg := tgbotapi.NewMessage(chatID, text)
-	_, err := bot.Send(msg)
+func sendMessage(m Messenger, chatID int64, text string) {
+	_, err := m.SendMessage(chatID, text, nil)
 	if err != nil {
 		log.Printf("Ошибка отправки сообщения: %v", err)
 	}
 }
 
+// показать экран с inline-клавиатурой, редактируя messageID (0 — новое сообщение)
+func showScreen(m Messenger, chatID int64, messageID int, text string, keyboard [][]tgbotapi.InlineKeyboardButton) {
+	var markup *tgbotapi.InlineKeyboardMarkup
+	if len(keyboard) > 0 {
+		tempMarkup := tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+		markup = &tempMarkup
+	}
+	if messageID != 0 {
+		if err := m.EditMessage(chatID, messageID, text, markup); err != nil {
+			log.Printf("Ошибка обновления сообщения: %v", err)
+		}
+		return
+	}
+	var sendMarkup interface{}
+	if markup != nil {
+		sendMarkup = markup
+	}
+	if _, err := m.SendMessage(chatID, text, sendMarkup); err != nil {
+		log.Printf("Ошибка отправки сообщения: %v", err)
+	}
+}
+
 // Обработчик нажатия кнопок
-func handleCallbackQuery(bot *tgbotapi.BotAPI, CallbackQuery *tgbotapi.CallbackQuery) {
+func handleCallbackQuery(m Messenger, CallbackQuery *tgbotapi.CallbackQuery) {
 	callbackID := CallbackQuery.ID
 	msgID := CallbackQuery.Message.MessageID
 	chatID := CallbackQuery.Message.Chat.ID
-	msgText := CallbackQuery.Message.Text
+	cb, err := decodeCallback(CallbackQuery.Data)
+	if err != nil {
+		log.Printf("Отклонена кнопка %q: %v", CallbackQuery.Data, err)
+		m.AnswerCallback(callbackID, "Кнопка устарела. Начните заново: /start")
+		return
+	}
 	//выбрали раздел комбинаторика
-	if CallbackQuery.Data == "Combinatorics" {
-		LevelsList(bot, CallbackQuery.Message)
+	if cb.Action == ActionCombinatorics {
+		LevelsList(m, chatID, msgID, CallbackQuery.From.ID, 0, 0, "")
+	}
+	//задания классов
+	if cb.Action == ActionAssignments {
+		AssignmentList(m, chatID, msgID, CallbackQuery.From.ID)
+	}
+	//курсы
+	if cb.Action == ActionCourseList {
+		CourseList(m, chatID, msgID, CallbackQuery.From.ID)
+	}
+	if cb.Action == ActionCourse {
+		CourseCard(m, chatID, msgID, CallbackQuery.From.ID, cb.IDs[0])
+	}
+	//листаем список упражнений
+	if cb.Action == ActionExerciseList {
+		LevelsList(m, chatID, msgID, CallbackQuery.From.ID, int(cb.IDs[0]), int(cb.IDs[1]), "")
 	}
 	//выбрали упражнение
-	if strings.HasPrefix(CallbackQuery.Data, "ExerciseID=") {
-		re := regexp.MustCompile(`\d+`)
-		numStr := re.FindString(CallbackQuery.Data) // возвращает "123"
-		ExerciseID, err := strconv.ParseInt(numStr, 10, 64)
-		if err != nil {
-			log.Printf("Ошибка конвертации: %v", err)
+	if cb.Action == ActionExercise || cb.Action == ActionStartExercise ||
+		cb.Action == ActionStartReverse || cb.Action == ActionStartOrder {
+		if reason := exerciseLockReason(CallbackQuery.From.ID, cb.IDs[0]); reason != "" {
+			m.AnswerCallback(callbackID, reason)
+			return
 		}
-		InitQuestionField(bot, CallbackQuery.Message, ExerciseID)
+	}
+	if cb.Action == ActionExercise {
+		ExerciseCard(m, CallbackQuery.Message, CallbackQuery.From.ID, cb.IDs[0])
+	}
+	//начали упражнение после описания
+	if cb.Action == ActionStartExercise {
+		InitQuestionField(m, CallbackQuery.Message, CallbackQuery.From.ID, cb.IDs[0])
+	}
+	if cb.Action == ActionStartReverse {
+		startExercise(m, CallbackQuery.Message, CallbackQuery.From.ID, cb.IDs[0], DirectionReverse, PracticeSentence)
+	}
+	if cb.Action == ActionStartOrder {
+		startExercise(m, CallbackQuery.Message, CallbackQuery.From.ID, cb.IDs[0], DirectionForward, PracticeOrder)
+	}
+	//части предложения в режиме «порядок слов»
+	if cb.Action == ActionOrderPick {
+		m.AnswerCallback(callbackID, handleOrderPick(m, CallbackQuery, cb))
+		return
+	}
+	//экранная клавиатура режима ввода
+	if cb.Action == ActionTypedLetter || cb.Action == ActionTypedBackspace || cb.Action == ActionTypedSubmit {
+		m.AnswerCallback(callbackID, handleTypedButton(m, CallbackQuery, cb))
+		return
 	}
 	//выбрали ответ
-	if strings.HasPrefix(CallbackQuery.Data, "ansID=") {
-		re := regexp.MustCompile(`\d+`)
-		numStr := re.FindString(CallbackQuery.Data) // возвращает "123"
-		optionID, err := strconv.ParseInt(numStr, 10, 64)
-		if err != nil {
-			log.Printf("Ошибка конвертации: %v", err)
+	if cb.Action == ActionAnswer {
+		optionID := cb.IDs[0]
+		nonce := cb.Nonce
+		if !sessionAllowsOption(CallbackQuery.From.ID, nonce, optionID) {
+			log.Printf("Кнопка ответа %d не из текущей сессии пользователя %d", optionID, CallbackQuery.From.ID)
+			m.AnswerCallback(callbackID, "Это упражнение уже неактивно. Откройте его заново")
+			return
 		}
-		//questions := initData()
-		currentAnswer, nextAnswer, currentIsRight, lastSubquestion, lastQuestion, prepinanie, err := ActuallyAnswer(optionID)
-		log.Printf(strconv.FormatBool(lastSubquestion)) //для компилятора
+		currentAnswer, nextAnswer, currentIsRight, lastSubquestion, lastQuestion, answerField, err := ActuallyAnswer(optionID, CallbackQuery.From.ID, nonce)
 		if err != nil {
 			log.Printf("не удалось найти вопрос: %v", err)
+			m.AnswerCallback(callbackID, "Вопрос не найден. Начните заново: /start")
+			return
+		}
+		recordAnswer(CallbackQuery.From.ID, nonce, currentAnswer.AnswerID, optionID, currentIsRight)
+		script := userScript(CallbackQuery.From.ID)
+		currentAnswer.Script = script
+		if nextAnswer != nil {
+			nextAnswer.Script = script
 		}
 		if currentIsRight {
 			if lastQuestion {
-				editText := tgbotapi.EditMessageTextConfig{
-					BaseEdit: tgbotapi.BaseEdit{
-						ChatID:    chatID,
-						MessageID: msgID,
-						//ReplyMarkup: &tempMarkup,
-					},
-					Text:      fmt.Sprintf("%s%s%s ✅", msgText, currentAnswer.Answer, prepinanie),
-					ParseMode: "",
-				}
-				bot.Send(editText)
-				//финальное сообщение
-				editText = tgbotapi.EditMessageTextConfig{
-					BaseEdit: tgbotapi.BaseEdit{
-						ChatID:    chatID,
-						MessageID: msgID,
-						//ReplyMarkup: &tempMarkup,
-					},
-					Text:      fmt.Sprintf("Упражнение закончено ✅"),
-					ParseMode: "",
-				}
-				bot.Send(editText)
-				LevelsList(bot, CallbackQuery.Message)
+				m.EditHTML(chatID, msgID, questionText(*currentAnswer, answerField, true), nil)
+				exerciseID := finishSession(CallbackQuery.From.ID, nonce)
+				//финальное сообщение: следующий шаг курса или список упражнений
+				afterExerciseFinished(m, CallbackQuery.Message, CallbackQuery.From.ID, exerciseID)
 			} else {
 				if lastSubquestion {
-					editText := tgbotapi.EditMessageTextConfig{
-						BaseEdit: tgbotapi.BaseEdit{
-							ChatID:    chatID,
-							MessageID: msgID,
-							//ReplyMarkup: &tempMarkup,
-						},
-						Text:      fmt.Sprintf("%s%s%s ✅", msgText, currentAnswer.Answer, prepinanie),
-						ParseMode: "",
-					}
-					bot.Send(editText)
-					//новое поле кнопок
-					InlineKeyboardButtonArray := []tgbotapi.InlineKeyboardButton{}
-					keyboard := [][]tgbotapi.InlineKeyboardButton{}
-					lineSize := 3
-					lineX := 1
-					for key, ans := range nextAnswer.Options {
-						InlineKeyboardButtonArray = append(InlineKeyboardButtonArray, tgbotapi.NewInlineKeyboardButtonData(ans, fmt.Sprintf("ansID=%d;", key)))
-						//log.Printf("кнопка: %v", fmt.Sprintf("ansID=%d;", key))
-						if lineX == lineSize {
-							keyboard = append(keyboard, InlineKeyboardButtonArray)
-							InlineKeyboardButtonArray = []tgbotapi.InlineKeyboardButton{}
-							lineX = 0
-						}
-						lineX++
-					}
-					keyboard = append(keyboard, InlineKeyboardButtonArray)
-
-					newMsg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Переведите предложение:\n%s \nПеревод: ", nextAnswer.Question))
-					tempMarkup := tgbotapi.NewInlineKeyboardMarkup(keyboard...)
-					newMsg.ReplyMarkup = &tempMarkup
-					bot.Send(newMsg)
+					m.EditHTML(chatID, msgID, questionText(*currentAnswer, answerField, true), nil)
+					m.SendHTML(chatID, questionPrompt(*nextAnswer), optionKeyboard(*nextAnswer, nonce, 0))
+					markQuestionSeen(CallbackQuery.From.ID, nextAnswer.QuestionID)
 				} else {
-					firstQuestions := nextAnswer
-					//log.Printf("Вариант ответа: %v", firstQuestions.Options[1])
-					InlineKeyboardButtonArray := []tgbotapi.InlineKeyboardButton{}
-					keyboard := [][]tgbotapi.InlineKeyboardButton{}
-					lineSize := 3
-					lineX := 1
-					for key, ans := range firstQuestions.Options {
-						InlineKeyboardButtonArray = append(InlineKeyboardButtonArray, tgbotapi.NewInlineKeyboardButtonData(ans, fmt.Sprintf("ansID=%d;", key)))
-						//log.Printf("кнопка: %v", fmt.Sprintf("ansID=%d;", key))
-						if lineX == lineSize {
-							keyboard = append(keyboard, InlineKeyboardButtonArray)
-							InlineKeyboardButtonArray = []tgbotapi.InlineKeyboardButton{}
-							lineX = 0
-						}
-						lineX++
-					}
-					keyboard = append(keyboard, InlineKeyboardButtonArray)
-					tempMarkup := tgbotapi.NewInlineKeyboardMarkup(keyboard...)
-					//newMsg.ReplyMarkup = &tempMarkup
-					if prepinanie == " " {
-						prepinanie = "\u00A0"
-					}
-					editText := tgbotapi.EditMessageTextConfig{
-						BaseEdit: tgbotapi.BaseEdit{
-							ChatID:      chatID,
-							MessageID:   msgID,
-							ReplyMarkup: &tempMarkup,
-						},
-						Text:      fmt.Sprintf("%s%s%s", msgText, currentAnswer.Answer, prepinanie),
-						ParseMode: "",
-					}
-					log.Printf("msgText: %s", msgText)
-					log.Printf("Answer: %s", currentAnswer.Answer)
-					fmt.Printf("prepinanie = %q, len = %d\n", prepinanie, len(prepinanie))
-					log.Printf(fmt.Sprintf("%s%s%s", msgText, prepinanie, currentAnswer.Answer))
-					bot.Send(editText)
+					m.EditHTML(chatID, msgID, questionText(*nextAnswer, answerField, false), optionKeyboard(*nextAnswer, nonce, 0))
 				}
 			}
 
 		} else {
-			firstQuestions := currentAnswer
-			//log.Printf("ответ неверный: %v", firstQuestions.Options[optionID])
-			//FirstOptions := FirstQuestions.Options
-			InlineKeyboardButtonArray := []tgbotapi.InlineKeyboardButton{}
-			keyboard := [][]tgbotapi.InlineKeyboardButton{}
-			lineSize := 3
-			lineX := 1
-			for key, ans := range firstQuestions.Options {
-				if key == optionID {
-					InlineKeyboardButtonArray = append(InlineKeyboardButtonArray, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("❌ %s", ans), fmt.Sprintf("ansID=%d;", key)))
-				} else {
-					InlineKeyboardButtonArray = append(InlineKeyboardButtonArray, tgbotapi.NewInlineKeyboardButtonData(ans, fmt.Sprintf("ansID=%d;", key)))
-				}
-				//log.Printf("кнопка: %v", fmt.Sprintf("ansID=%d;", key))
-				if lineX == lineSize {
-					keyboard = append(keyboard, InlineKeyboardButtonArray)
-					InlineKeyboardButtonArray = []tgbotapi.InlineKeyboardButton{}
-					lineX = 0
-				}
-				lineX++
-			}
-			keyboard = append(keyboard, InlineKeyboardButtonArray)
-			tempMarkup := tgbotapi.NewInlineKeyboardMarkup(keyboard...)
-			//newMsg.ReplyMarkup = &tempMarkup
-
-			editText := tgbotapi.EditMessageTextConfig{
-				BaseEdit: tgbotapi.BaseEdit{
-					ChatID:      chatID,
-					MessageID:   msgID,
-					ReplyMarkup: &tempMarkup,
-				},
-				Text:      fmt.Sprintf(msgText),
-				ParseMode: "",
-			}
-			bot.Send(editText)
+			m.EditHTML(chatID, msgID, questionText(*currentAnswer, answerField, false), optionKeyboard(*currentAnswer, nonce, optionID))
 		}
 	}
 
-	answerCbq := tgbotapi.CallbackConfig{
-		CallbackQueryID: callbackID,
-		Text:            "Обработка выполнена",
-		ShowAlert:       false,
-	}
-	bot.Request(answerCbq)
+	m.AnswerCallback(callbackID, "Обработка выполнена")
 }
 
 // сформировать форму упражения
-func InitQuestionField(bot *tgbotapi.BotAPI, msg *tgbotapi.Message, ExerciseID int64) {
-
-	firstQuestions := LoadItem(ExerciseID)
-	//FirstOptions := FirstQuestions.Options
-	InlineKeyboardButtonArray := []tgbotapi.InlineKeyboardButton{}
-	keyboard := [][]tgbotapi.InlineKeyboardButton{}
-	lineSize := 3
-	lineX := 1
-	for key, ans := range firstQuestions.Options {
-		InlineKeyboardButtonArray = append(InlineKeyboardButtonArray, tgbotapi.NewInlineKeyboardButtonData(ans, fmt.Sprintf("ansID=%d;", key)))
-		//log.Printf("кнопка: %v", fmt.Sprintf("ansID=%d;", key))
-		if lineX == lineSize {
-			keyboard = append(keyboard, InlineKeyboardButtonArray)
-			InlineKeyboardButtonArray = []tgbotapi.InlineKeyboardButton{}
-			lineX = 0
-		}
-		lineX++
-	}
-	keyboard = append(keyboard, InlineKeyboardButtonArray)
-
-	newMsg := tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("Переведите предложение:\n%s \nПеревод: ", firstQuestions.Question))
-	tempMarkup := tgbotapi.NewInlineKeyboardMarkup(keyboard...)
-	newMsg.ReplyMarkup = &tempMarkup
-	bot.Send(newMsg)
+func InitQuestionField(m Messenger, msg *tgbotapi.Message, userID int64, ExerciseID int64) {
+	startExercise(m, msg, userID, ExerciseID, DirectionForward, exerciseTypeOf(exerciseTypeName(ExerciseID)).Practice)
 }
 
-// получить текущий следующий вопрос и признак правильного ответа
-func ActuallyAnswer(optionID int64) (current *Item, next *Item, currentIsRight bool, lastSubquestion bool, lastQuestion bool, prepinanie string, err error) {
-	db, err := sql.Open("sqlite", "bot.db")
-	if err != nil {
-		log.Fatal(err)
+// начать попытку упражнения в заданном направлении перевода и режиме практики
+func startExercise(m Messenger, msg *tgbotapi.Message, userID int64, ExerciseID int64, direction string, practice string) {
+	switch duelInProgress(userID) {
+	case DuelWaiting:
+		sendMessage(m, msg.Chat.ID, "Вы ждёте соперника в дуэли: когда он придёт, новая попытка прервалась бы. Отменить дуэль: /duel cancel")
+		return
+	case DuelActive:
+		sendMessage(m, msg.Chat.ID, "Сначала закончите дуэль или сдайтесь: /duel cancel")
+		return
 	}
-	defer db.Close()
-
-	const queryItem = `WITH current AS (
-    SELECT
-        1 AS sort_order,
-        'current' AS row_type,
-
-        q.id    AS question_id,
-        q.text  AS question_text,
-
-        sq.id   AS subquestion_id,
-        sq.text AS subquestion_text,
-        sq.seq_num,
-
-        CASE WHEN o.text = sq.text THEN 1 ELSE 0 END AS currentIsRight,
-
-        CASE
-            WHEN sq.seq_num = (
-                SELECT MAX(seq_num)
-                FROM SubQuestion
-                WHERE question_id = q.id
-            )
-            THEN 1 ELSE 0
-        END AS lastSubquestion,
-		NULL AS prepinanie
-    FROM Option o
-    JOIN SubQuestion sq ON sq.id = o.sub_question_id
-    JOIN Question q ON q.id = sq.question_id
-    WHERE o.id = ?
-	),
-
-	next_step AS (
-    -- следующий SubQuestion
-    SELECT
-    2 AS sort_order,
-    'next' AS row_type,
-
-    q.id    AS question_id,
-    q.text  AS question_text,
-
-    sq.id   AS subquestion_id,
-    sq.text AS subquestion_text,
-    sq.seq_num,
-
-    NULL AS currentIsRight,
-    NULL AS lastSubquestion,
-
-   CASE
-    WHEN EXISTS (
-        SELECT 1
-        FROM SubQuestion sq1
-        WHERE sq1.question_id = c.question_id
-          AND sq1.seq_num = c.seq_num + 1
-          AND sq1.pointing = 1
-    )
-    THEN (
-        SELECT sq1.text
-        FROM SubQuestion sq1
-        WHERE sq1.question_id = c.question_id
-          AND sq1.seq_num = c.seq_num + 1
-          AND sq1.pointing = 1
-        LIMIT 1
-    )
-    ELSE ''
-	END AS prepinanie
-
-	FROM current c
-	JOIN SubQuestion sq
-    ON sq.question_id = c.question_id
-   AND sq.seq_num = (
-        CASE
-            WHEN EXISTS (
-                SELECT 1
-                FROM SubQuestion sq1
-                WHERE sq1.question_id = c.question_id
-                  AND sq1.seq_num = c.seq_num + 1
-                  AND sq1.pointing = 1
-            )
-            THEN c.seq_num + 2
-            ELSE c.seq_num + 1
-        END
-   )
-	JOIN Question q ON q.id = sq.question_id
-	WHERE c.lastSubquestion = 0
-
-
-    UNION ALL
-
-    -- первый SubQuestion следующего Question
-    SELECT
-        2 AS sort_order,
-        'next' AS row_type,
-
-        q2.id   AS question_id,
-        q2.text AS question_text,
-
-        sq2.id  AS subquestion_id,
-        sq2.text AS subquestion_text,
-        sq2.seq_num,
-
-        NULL AS currentIsRight,
-        NULL AS lastSubquestion,
-		NULL AS prepinanie
-    FROM current c
-    JOIN Question q2
-        ON q2.exercise_id = (
-            SELECT exercise_id
-            FROM Question
-            WHERE id = c.question_id
-        )
-       AND q2.id > c.question_id
-    JOIN SubQuestion sq2 ON sq2.question_id = q2.id
-    WHERE c.lastSubquestion = 1
-      AND sq2.seq_num = (
-          SELECT MIN(seq_num)
-          FROM SubQuestion
-          WHERE question_id = q2.id
-      )
-    ORDER BY q2.id
-    LIMIT 1
-	)
-
-	SELECT 
-		question_id,
-		question_text,
-		subquestion_id,
-		subquestion_text,
-		seq_num,
-		currentIsRight,
-		lastSubquestion,
-		COALESCE(prepinanie, '') AS prepinanie
-	FROM (
-		SELECT * FROM current
-		UNION ALL
-		SELECT * FROM next_step
-	)
-	ORDER BY sort_order;`
-	// SQL-запрос
-	rows, err := db.Query(queryItem, optionID)
-	if err != nil {
-		log.Fatal(err)
+	nonce := startSession(userID, ExerciseID, direction, practice)
+	plan := planSessionQuestions(userID, nonce, ExerciseID, direction)
+	if len(plan) == 0 {
+		sendMessage(m, msg.Chat.ID, "В этом упражнении пока нет вопросов")
+		return
 	}
-	defer rows.Close()
-	current = &Item{
-		Options: make(map[int64]string),
-	}
-
-	if rows.Next() {
-		var dummyPrepinanie sql.NullString
-		if err := rows.Scan(
-			&current.QuestionID,
-			&current.Question,
-			&current.AnswerID,
-			&current.Answer,
-			&current.SeqNum,
-			&currentIsRight,
-			&lastSubquestion,
-			&dummyPrepinanie); err != nil {
-			log.Fatal(err)
-		}
-		const queryOptions = `SELECT id, text
-		FROM Option
-		WHERE sub_question_id = ?
-		ORDER BY id;`
-		rowsOptions, err := db.Query(queryOptions, current.AnswerID)
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer rowsOptions.Close()
-
-		for rowsOptions.Next() {
-			var optID int64
-			var text string
-
-			if err := rowsOptions.Scan(&optID, &text); err != nil {
-				log.Fatal(err)
-			}
+	sendFirstQuestion(m, msg.Chat.ID, userID, nonce, ExerciseID, direction, practice, plan)
+}
 
-			current.Options[optID] = text
-		}
+// отправить первый вопрос попытки по её плану
+func sendFirstQuestion(m Messenger, chatID int64, userID int64, nonce uint32, ExerciseID int64, direction string, practice string, plan []int64) {
+	firstQuestions := LoadItem(plan[0], direction)
+	firstQuestions.Number, firstQuestions.Total = 1, len(plan)
+	firstQuestions.Script = userScript(userID)
+	markQuestionSeen(userID, plan[0])
+	if practice == PracticeOrder {
+		sendOrderQuestion(m, chatID, userID, nonce, firstQuestions)
+		return
 	}
-
-	next = &Item{
-		Options: make(map[int64]string),
-	}
-	if rows.Next() {
-		var dummyRight sql.NullBool
-		var dummyLast sql.NullBool
-		if err := rows.Scan(
-			&next.QuestionID,
-			&next.Question,
-			&next.AnswerID,
-			&next.Answer,
-			&next.SeqNum,
-			&dummyRight,
-			&dummyLast,
-			&prepinanie); err != nil {
-			log.Fatal(err)
-		}
-		const queryOptions = `SELECT id, text
-		FROM Option
-		WHERE sub_question_id = ?
-		ORDER BY id;`
-		rowsOptions, err := db.Query(queryOptions, next.AnswerID)
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer rowsOptions.Close()
-
-		for rowsOptions.Next() {
-			var optID int64
-			var text string
-
-			if err := rowsOptions.Scan(&optID, &text); err != nil {
-				log.Fatal(err)
-			}
-
-			next.Options[optID] = text
-		}
-	} else {
-		lastQuestion = true
+	if mode := exerciseAnswerMode(ExerciseID); mode != AnswerButtons && exerciseTypeOf(firstQuestions.Type).Extras {
+		sendTypedQuestion(m, chatID, userID, nonce, mode, firstQuestions)
+		return
 	}
-
-	return current, next, currentIsRight, lastSubquestion, lastQuestion, prepinanie, nil
+	m.SendHTML(chatID, questionPrompt(firstQuestions), optionKeyboard(firstQuestions, nonce, 0))
 }
 
-// вывести список упражнений
-func LevelsList(bot *tgbotapi.BotAPI, msg *tgbotapi.Message) {
-	db, err := sql.Open("sqlite", "bot.db")
-	if err != nil {
-		log.Fatal(err)
-	}
+// получить текущий и следующий подвопрос и признак правильного ответа;
+// answerField — поле ответа после этого ответа: до следующего подвопроса,
+// а при неверном ответе — до текущего
+func ActuallyAnswer(optionID int64, userID int64, nonce uint32) (current *Item, next *Item, currentIsRight bool, lastSubquestion bool, lastQuestion bool, answerField string, err error) {
+	db := openDB()
 	defer db.Close()
 
-	// SQL-запрос
-	rows, err := db.Query(`SELECT title,ID FROM Exercise`)
+	current = &Item{}
+	option := answerOption{ID: optionID}
+	err = db.QueryRow(`SELECT
+			q.id,
+			q.text,
+			sq.id,
+			sq.text,
+			sq.seq_num,
+			sq.direction,
+			e.type,
+			o.text
+		FROM Option o
+		JOIN SubQuestion sq ON sq.id = o.sub_question_id
+		JOIN Question q ON q.id = sq.question_id
+		JOIN Exercise e ON e.id = q.exercise_id
+		WHERE o.id = ?`, optionID).Scan(
+		&current.QuestionID,
+		&current.Question,
+		&current.AnswerID,
+		&current.Answer,
+		&current.SeqNum,
+		&current.Direction,
+		&current.Type,
+		&option.Text)
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, false, false, false, "", err
+	}
+	current.Options = loadOptions(db, current.AnswerID)
+	if current.Direction == DirectionReverse {
+		current.Question = tatarSentence(db, current.QuestionID)
 	}
-	defer rows.Close()
 
-	var title string
-	var id int
+	current.Number, current.Total = sessionQuestionPosition(db, userID, nonce, current.QuestionID)
 
-	InlineKeyboardButtonArray := []tgbotapi.InlineKeyboardButton{}
-	keyboard := [][]tgbotapi.InlineKeyboardButton{}
-	for rows.Next() {
-		if err := rows.Scan(&title, &id); err != nil {
-			log.Fatal(err)
+	subs := loadSubQuestions(db, current.QuestionID, current.Direction)
+	current.Parts = subs
+	currentIdx, nextIdx := 0, len(subs)
+	for i, sub := range subs {
+		if sub.ID == current.AnswerID {
+			currentIdx, nextIdx = i, nextAnswerable(subs, i+1)
+			break
+		}
+	}
+	current.Word, current.Words = answerablePosition(subs, currentIdx)
+	currentIsRight = exerciseTypeOf(current.Type).check(*current, option)
+	if !currentIsRight {
+		return current, nil, false, false, false, renderAnswerField(subs[:currentIdx]), nil
+	}
+	answerField = renderAnswerField(subs[:nextIdx])
+	if nextIdx < len(subs) {
+		next = &Item{
+			Question:   current.Question,
+			QuestionID: current.QuestionID,
+			Answer:     subs[nextIdx].Text,
+			AnswerID:   subs[nextIdx].ID,
+			SeqNum:     subs[nextIdx].SeqNum,
+			Number:     current.Number,
+			Total:      current.Total,
+			Direction:  current.Direction,
+			Type:       current.Type,
+			Parts:      subs,
+			Options:    loadOptions(db, subs[nextIdx].ID),
 		}
-		InlineKeyboardButtonArray = append(InlineKeyboardButtonArray, tgbotapi.NewInlineKeyboardButtonData(title, fmt.Sprintf("ExerciseID=%d;", id)))
-		keyboard = append(keyboard, InlineKeyboardButtonArray)
-		InlineKeyboardButtonArray = []tgbotapi.InlineKeyboardButton{}
+		next.Word, next.Words = answerablePosition(subs, nextIdx)
+		return current, next, currentIsRight, false, false, answerField, nil
 	}
-	keyboard = append(keyboard, InlineKeyboardButtonArray)
-	newMsg := tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("Выберите упражнение"))
-	tempMarkup := tgbotapi.NewInlineKeyboardMarkup(keyboard...)
-	newMsg.ReplyMarkup = &tempMarkup
-	bot.Send(newMsg)
 
+	// вопрос собран: следующий вопрос по плану сессии
+	nextQuestionID, ok := nextPlannedQuestion(db, userID, nonce, current.QuestionID)
+	if !ok {
+		return current, &Item{}, currentIsRight, true, true, answerField, nil
+	}
+	item := loadQuestionItem(db, nextQuestionID, current.Direction)
+	item.Number, item.Total = current.Number+1, current.Total
+	return current, &item, currentIsRight, true, false, answerField, nil
 }
 
-// получить первый вопрос из упражнения
-func LoadItem(ExerciseID int64) Item {
-	db, err := sql.Open("sqlite", "bot.db")
-	if err != nil {
-		log.Fatal(err)
-	}
+// получить первый подвопрос вопроса
+func LoadItem(QuestionID int64, direction string) Item {
+	db := openDB()
 	defer db.Close()
+	return loadQuestionItem(db, QuestionID, direction)
+}
 
-	data := Item{
-		Options: make(map[int64]string),
-	}
-
-	const queryItem = `
-		SELECT
-			q.text        AS Question,
-			q.id          AS QuestionID,
-			sq.text       AS Answer,
-			sq.id         AS AnswerID,
-			sq.seq_num    AS SeqNum,
-			sq.pointing   AS Prepinanie
-		FROM Question q
-		JOIN SubQuestion sq ON sq.question_id = q.id
-		WHERE q.exercise_id = ?
-		AND q.id = (
-			SELECT id
-			FROM Question
-			WHERE exercise_id = ?
-			ORDER BY id
-			LIMIT 1
-		)
-		AND sq.seq_num = (
-			SELECT seq_num
-			FROM SubQuestion
-			WHERE question_id = q.id
-			ORDER BY seq_num
-			LIMIT 1
-		);`
-
-	row := db.QueryRow(queryItem, ExerciseID, ExerciseID)
-
-	err = row.Scan(
-		&data.Question,
-		&data.QuestionID,
-		&data.Answer,
-		&data.AnswerID,
-		&data.SeqNum,
-		&data.Prepinanie,
-	)
+// первый подвопрос для ответа и пунктуация перед ним
+func loadQuestionItem(db *sql.DB, questionID int64, direction string) Item {
+	data := Item{QuestionID: questionID, Direction: direction}
+	err := db.QueryRow(`SELECT q.text, e.type FROM Question q JOIN Exercise e ON e.id = q.exercise_id WHERE q.id = ?`,
+		questionID).Scan(&data.Question, &data.Type)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			log.Fatal(err)
-		}
 		log.Fatal(err)
 	}
-
-	const queryOptions = `SELECT id, text
-		FROM Option
-		WHERE sub_question_id = ?
-		ORDER BY id;`
-	rows, err := db.Query(queryOptions, data.AnswerID)
-	if err != nil {
-		log.Fatal(err)
+	if direction == DirectionReverse {
+		data.Question = tatarSentence(db, questionID)
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var optID int64
-		var text string
-
-		if err := rows.Scan(&optID, &text); err != nil {
-			log.Fatal(err)
-		}
 
-		data.Options[optID] = text
+	subs := loadSubQuestions(db, questionID, direction)
+	data.Parts = subs
+	first := nextAnswerable(subs, 0)
+	if first == len(subs) {
+		log.Fatalf("В вопросе %d нет подвопросов для ответа", questionID)
 	}
-
+	data.Lead = renderAnswerField(subs[:first])
+	data.Answer = subs[first].Text
+	data.AnswerID = subs[first].ID
+	data.SeqNum = subs[first].SeqNum
+	data.Word, data.Words = answerablePosition(subs, first)
+	data.Options = loadOptions(db, data.AnswerID)
 	return data
 }
+
+// открыть базу данных бота
+func openDB() *sql.DB {
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return db
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Сравнение введённого ответа с правильным. Регистр, знаки препинания и
+// лишние пробелы не важны. Латинские и прочие буквы, которые выглядят как
+// кириллица, считаются кириллицей. Русские замены татарских букв (а вместо ә,
+// ж вместо җ и т. п.) принимаются с подсказкой, а небольшая опечатка даёт
+// ответ «почти».
+
+// буквы-двойники в нижнем регистре: выглядят одинаково, ученик не видит разницы
+var lookalikeLetters = map[rune]rune{
+	'ə': 'ә', 'ǝ': 'ә', // латинская шва
+	'ɵ': 'ө', 'ꙩ': 'ө',
+	'ұ': 'ү',
+	'ӂ': 'җ',
+	'ӊ': 'ң', 'ӈ': 'ң', 'ŋ': 'ң',
+	'h': 'һ',
+	'a': 'а', 'e': 'е', 'o': 'о', 'p': 'р', 'c': 'с', 'x': 'х', 'y': 'у',
+	'ё': 'е',
+}
+
+// двойники только среди заглавных: заменяются до перевода в нижний регистр
+var upperLookalikeLetters = map[rune]rune{
+	'B': 'в', 'H': 'н', 'K': 'к', 'M': 'м', 'T': 'т',
+}
+
+// замены татарских букв, которыми пользуются без татарской раскладки
+var tatarSubstitutes = map[rune]rune{
+	'а': 'ә', 'ä': 'ә', 'э': 'ә',
+	'о': 'ө', 'ö': 'ө',
+	'у': 'ү', 'ü': 'ү',
+	'ж': 'җ',
+	'н': 'ң', 'ñ': 'ң',
+	'х': 'һ',
+}
+
+// подсказка к ответу, засчитанному с заменой татарских букв
+const letterHint = "Верно! Обратите внимание на татарские буквы: "
+
+// typedVerdict — результат проверки введённого ответа
+type typedVerdict int
+
+const (
+	typedWrong  typedVerdict = iota
+	typedRight               // совпало точно
+	typedLetter              // совпало с заменой татарских букв
+	typedAlmost              // опечатка в пределах допуска
+)
+
+// typedMatch — результат проверки с сообщением для ученика
+type typedMatch struct {
+	Verdict  typedVerdict
+	Feedback string
+}
+
+// ответ засчитывается
+func (m typedMatch) right() bool {
+	return m.Verdict == typedRight || m.Verdict == typedLetter
+}
+
+// ученик получил подсказку: к букве или к написанию
+func (m typedMatch) hint() bool {
+	return m.Verdict == typedLetter || m.Verdict == typedAlmost
+}
+
+// привести ответ к виду для сравнения: нижний регистр, без знаков
+// препинания, буквы-двойники заменены, пробелы схлопнуты
+func normalizeAnswer(text string) string {
+	var out strings.Builder
+	space := false
+	for _, r := range text {
+		if same, ok := upperLookalikeLetters[r]; ok {
+			r = same
+		}
+		r = unicode.ToLower(r)
+		if unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r) {
+			space = out.Len() > 0
+			continue
+		}
+		if space {
+			out.WriteRune(' ')
+			space = false
+		}
+		if same, ok := lookalikeLetters[r]; ok {
+			r = same
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
+
+// совпадает ли ответ с правильным, если разрешить русские замены татарских букв
+func matchesWithSubstitutes(typed, expected string) bool {
+	t, e := []rune(typed), []rune(expected)
+	if len(t) != len(e) {
+		return false
+	}
+	for i := range t {
+		if t[i] == e[i] {
+			continue
+		}
+		if tatarSubstitutes[t[i]] != e[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// введённый текст — начало правильного ответа (с учётом замен букв)
+func isAnswerPrefix(typed, expected string) bool {
+	t, e := normalizeAnswer(typed), normalizeAnswer(expected)
+	if t == "" || len(t) >= len(e) {
+		return false
+	}
+	return matchesWithSubstitutes(t, string([]rune(e)[:utf8.RuneCountInString(t)]))
+}
+
+// сколько опечаток допускается в ответе такой длины
+func typoTolerance(expected string) int {
+	switch n := utf8.RuneCountInString(expected); {
+	case n < 4:
+		return 0
+	case n <= 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// расстояние Левенштейна по символам
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// длина общего начала строк в символах
+func commonPrefix(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	n := 0
+	for n < len(ra) && n < len(rb) && ra[n] == rb[n] {
+		n++
+	}
+	return n
+}
+
+// проверить введённый ответ
+func matchTypedAnswer(typed, expected string) typedMatch {
+	t, e := normalizeAnswer(typed), normalizeAnswer(expected)
+	switch {
+	case t == e:
+		return typedMatch{Verdict: typedRight}
+	case matchesWithSubstitutes(t, e):
+		return typedMatch{Verdict: typedLetter, Feedback: letterHint + expected}
+	}
+	if tolerance := typoTolerance(e); tolerance > 0 && editDistance(t, e) <= tolerance {
+		// ошибка во второй половине слова — скорее всего, в аффиксе
+		if commonPrefix(t, e)*2 >= utf8.RuneCountInString(e) {
+			return typedMatch{Verdict: typedAlmost, Feedback: "Почти — проверьте окончание"}
+		}
+		return typedMatch{Verdict: typedAlmost, Feedback: "Почти — проверьте написание"}
+	}
+	// основа без аффикса: набрана половина слова или больше
+	if isAnswerPrefix(typed, expected) && utf8.RuneCountInString(t)*2 >= utf8.RuneCountInString(e) {
+		return typedMatch{Verdict: typedAlmost, Feedback: "Почти — проверьте окончание"}
+	}
+	return typedMatch{Verdict: typedWrong, Feedback: "❌ Неверно, попробуйте ещё раз"}
+}
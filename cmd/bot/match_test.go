@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestMatchTypedAnswer(t *testing.T) {
+	tests := []struct {
+		typed, expected string
+		want            typedVerdict
+		feedback        string
+	}{
+		{"бетерәсез", "бетерәсез", typedRight, ""},
+		{"  Бетерәсез! ", "бетерәсез", typedRight, ""},
+		{"Мин укыйм , син язасың", "Мин укыйм, син язасың.", typedRight, ""},
+		{"бетерəсез", "бетерәсез", typedRight, ""},                  // латинская шва
+		{"hәм", "һәм", typedRight, ""},                              // латинская h
+		{"MИH", "мин", typedRight, ""},                              // латинские заглавные M и H
+		{"Tым", "тым", typedRight, ""},                              // латинская заглавная T
+		{"bar", "вар", typedWrong, "❌ Неверно, попробуйте ещё раз"}, // строчная b — не «в»
+		{"укыйм", "укыйм", typedRight, ""},
+		{"бетерэсез", "бетерәсез", typedLetter, "Верно! Обратите внимание на татарские буквы: бетерәсез"},
+		{"жир", "җир", typedLetter, "Верно! Обратите внимание на татарские буквы: җир"},
+		{"куз", "күз", typedLetter, "Верно! Обратите внимание на татарские буквы: күз"},
+		{"бетерәсес", "бетерәсез", typedAlmost, "Почти — проверьте окончание"},
+		{"петерәсез", "бетерәсез", typedAlmost, "Почти — проверьте написание"},
+		{"бетер", "бетерәсез", typedAlmost, "Почти — проверьте окончание"}, // основа без аффикса
+		{"бет", "бетерәсез", typedWrong, "❌ Неверно, попробуйте ещё раз"},
+		{"ә", "и", typedWrong, "❌ Неверно, попробуйте ещё раз"},
+		{"язасың", "укыйсың", typedWrong, "❌ Неверно, попробуйте ещё раз"},
+	}
+	for _, tt := range tests {
+		got := matchTypedAnswer(tt.typed, tt.expected)
+		if got.Verdict != tt.want || got.Feedback != tt.feedback {
+			t.Errorf("matchTypedAnswer(%q, %q) = %v %q, ожидалось %v %q",
+				tt.typed, tt.expected, got.Verdict, got.Feedback, tt.want, tt.feedback)
+		}
+	}
+}
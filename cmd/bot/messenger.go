@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Messenger — транспорт, через который обработчики общаются с пользователем.
+// В боевом режиме это Telegram, в тестах — fakeMessenger.
+type Messenger interface {
+	// SendMessage отправляет новое сообщение и возвращает его MessageID
+	SendMessage(chatID int64, text string, markup interface{}) (int, error)
+	// EditMessage заменяет текст и клавиатуру сообщения; markup == nil убирает клавиатуру
+	EditMessage(chatID int64, messageID int, text string, markup *tgbotapi.InlineKeyboardMarkup) error
+	// SendHTML — SendMessage с разметкой HTML; текст из базы должен быть экранирован
+	SendHTML(chatID int64, text string, markup interface{}) (int, error)
+	// EditHTML — EditMessage с разметкой HTML
+	EditHTML(chatID int64, messageID int, text string, markup *tgbotapi.InlineKeyboardMarkup) error
+	// AnswerCallback подтверждает нажатие inline-кнопки
+	AnswerCallback(callbackID string, text string) error
+	// SendAudio отправляет аудиофайл (раздел «Аудирование»)
+	SendAudio(chatID int64, file tgbotapi.RequestFileData, caption string) (int, error)
+	// SendDocument отправляет файл (отчёты учителя)
+	SendDocument(chatID int64, file tgbotapi.RequestFileData, caption string) (int, error)
+	// SetCommands задаёт меню команд Telegram для области видимости
+	SetCommands(scope tgbotapi.BotCommandScope, commands []tgbotapi.BotCommand) error
+	// SendQuiz отправляет неанонимный опрос-викторину; correct — индекс верного варианта,
+	// openPeriod — через сколько Telegram сам закроет опрос.
+	// Возвращает MessageID и id опроса, по которому придут ответы (poll_answer)
+	SendQuiz(chatID int64, question string, options []string, correct int, openPeriod time.Duration) (int, string, error)
+	// StopPoll закрывает опрос
+	StopPoll(chatID int64, messageID int) error
+}
+
+// telegramMessenger — адаптер Messenger поверх tgbotapi
+type telegramMessenger struct {
+	bot *tgbotapi.BotAPI
+}
+
+func newTelegramMessenger(bot *tgbotapi.BotAPI) *telegramMessenger {
+	return &telegramMessenger{bot: bot}
+}
+
+func (t *telegramMessenger) SendMessage(chatID int64, text string, markup interface{}) (int, error) {
+	return t.send(chatID, text, "", markup)
+}
+
+func (t *telegramMessenger) SendHTML(chatID int64, text string, markup interface{}) (int, error) {
+	return t.send(chatID, text, tgbotapi.ModeHTML, markup)
+}
+
+func (t *telegramMessenger) send(chatID int64, text string, parseMode string, markup interface{}) (int, error) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = parseMode
+	if markup != nil {
+		msg.ReplyMarkup = markup
+	}
+	sent, err := t.bot.Send(msg)
+	if err != nil {
+		return 0, err
+	}
+	return sent.MessageID, nil
+}
+
+func (t *telegramMessenger) EditMessage(chatID int64, messageID int, text string, markup *tgbotapi.InlineKeyboardMarkup) error {
+	return t.edit(chatID, messageID, text, "", markup)
+}
+
+func (t *telegramMessenger) EditHTML(chatID int64, messageID int, text string, markup *tgbotapi.InlineKeyboardMarkup) error {
+	return t.edit(chatID, messageID, text, tgbotapi.ModeHTML, markup)
+}
+
+func (t *telegramMessenger) edit(chatID int64, messageID int, text string, parseMode string, markup *tgbotapi.InlineKeyboardMarkup) error {
+	editText := tgbotapi.EditMessageTextConfig{
+		BaseEdit: tgbotapi.BaseEdit{
+			ChatID:      chatID,
+			MessageID:   messageID,
+			ReplyMarkup: markup,
+		},
+		Text:      text,
+		ParseMode: parseMode,
+	}
+	_, err := t.bot.Send(editText)
+	return err
+}
+
+func (t *telegramMessenger) AnswerCallback(callbackID string, text string) error {
+	_, err := t.bot.Request(tgbotapi.NewCallback(callbackID, text))
+	return err
+}
+
+func (t *telegramMessenger) SendAudio(chatID int64, file tgbotapi.RequestFileData, caption string) (int, error) {
+	audio := tgbotapi.NewAudio(chatID, file)
+	audio.Caption = caption
+	sent, err := t.bot.Send(audio)
+	if err != nil {
+		return 0, err
+	}
+	return sent.MessageID, nil
+}
+
+func (t *telegramMessenger) SendDocument(chatID int64, file tgbotapi.RequestFileData, caption string) (int, error) {
+	doc := tgbotapi.NewDocument(chatID, file)
+	doc.Caption = caption
+	sent, err := t.bot.Send(doc)
+	if err != nil {
+		return 0, err
+	}
+	return sent.MessageID, nil
+}
+
+func (t *telegramMessenger) SendQuiz(chatID int64, question string, options []string, correct int, openPeriod time.Duration) (int, string, error) {
+	poll := tgbotapi.NewPoll(chatID, question, options...)
+	poll.Type = "quiz"
+	poll.IsAnonymous = false // иначе Telegram не присылает poll_answer
+	poll.CorrectOptionID = int64(correct)
+	poll.OpenPeriod = int(openPeriod / time.Second)
+	sent, err := t.bot.Send(poll)
+	if err != nil {
+		return 0, "", err
+	}
+	if sent.Poll == nil {
+		return sent.MessageID, "", fmt.Errorf("Telegram не вернул опрос")
+	}
+	return sent.MessageID, sent.Poll.ID, nil
+}
+
+func (t *telegramMessenger) StopPoll(chatID int64, messageID int) error {
+	_, err := t.bot.Request(tgbotapi.NewStopPoll(chatID, messageID))
+	return err
+}
+
+func (t *telegramMessenger) SetCommands(scope tgbotapi.BotCommandScope, commands []tgbotapi.BotCommand) error {
+	_, err := t.bot.Request(tgbotapi.NewSetMyCommandsWithScope(scope, commands...))
+	return err
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeMessage — сообщение в «чате» fakeMessenger
+type fakeMessage struct {
+	ChatID    int64
+	MessageID int
+	Text      string
+	HTML      bool // текст с разметкой HTML
+	Markup    interface{}
+}
+
+// fakeMessenger — Messenger в памяти: хранит текущее состояние сообщений
+// и журнал всех исходящих вызовов
+type fakeMessenger struct {
+	lastID    int
+	messages  map[int]*fakeMessage
+	sent      []fakeMessage
+	edits     []fakeMessage
+	callbacks []string
+	audio     []fakeMessage
+	documents []fakeDocument
+	menus     map[string][]tgbotapi.BotCommand
+	polls     []fakePoll
+}
+
+// fakePoll — опрос-викторина в «чате» fakeMessenger
+type fakePoll struct {
+	ChatID    int64
+	MessageID int
+	ID        string
+	Question  string
+	Options   []string
+	Correct   int
+	Period    time.Duration
+	Closed    bool
+}
+
+// fakeDocument — отправленный файл
+type fakeDocument struct {
+	ChatID  int64
+	Name    string
+	Bytes   []byte
+	Caption string
+}
+
+func newFakeMessenger() *fakeMessenger {
+	return &fakeMessenger{
+		messages: make(map[int]*fakeMessage),
+		menus:    make(map[string][]tgbotapi.BotCommand),
+	}
+}
+
+// Telegram обрезает пробелы в конце текста, фейк делает так же
+func telegramTrim(text string) string {
+	return strings.TrimRight(text, " \t\n")
+}
+
+func (f *fakeMessenger) SendMessage(chatID int64, text string, markup interface{}) (int, error) {
+	return f.send(chatID, text, false, markup)
+}
+
+func (f *fakeMessenger) SendHTML(chatID int64, text string, markup interface{}) (int, error) {
+	return f.send(chatID, text, true, markup)
+}
+
+func (f *fakeMessenger) send(chatID int64, text string, html bool, markup interface{}) (int, error) {
+	f.lastID++
+	msg := fakeMessage{ChatID: chatID, MessageID: f.lastID, Text: telegramTrim(text), HTML: html, Markup: markup}
+	f.messages[msg.MessageID] = &msg
+	f.sent = append(f.sent, msg)
+	return msg.MessageID, nil
+}
+
+func (f *fakeMessenger) EditMessage(chatID int64, messageID int, text string, markup *tgbotapi.InlineKeyboardMarkup) error {
+	return f.edit(chatID, messageID, text, false, markup)
+}
+
+func (f *fakeMessenger) EditHTML(chatID int64, messageID int, text string, markup *tgbotapi.InlineKeyboardMarkup) error {
+	return f.edit(chatID, messageID, text, true, markup)
+}
+
+func (f *fakeMessenger) edit(chatID int64, messageID int, text string, html bool, markup *tgbotapi.InlineKeyboardMarkup) error {
+	msg, ok := f.messages[messageID]
+	if !ok {
+		msg = &fakeMessage{ChatID: chatID, MessageID: messageID}
+		f.messages[messageID] = msg
+	}
+	msg.Text = telegramTrim(text)
+	msg.HTML = html
+	msg.Markup = nil
+	if markup != nil {
+		msg.Markup = markup
+	}
+	f.edits = append(f.edits, *msg)
+	return nil
+}
+
+func (f *fakeMessenger) AnswerCallback(callbackID string, text string) error {
+	f.callbacks = append(f.callbacks, callbackID)
+	return nil
+}
+
+func (f *fakeMessenger) SendAudio(chatID int64, file tgbotapi.RequestFileData, caption string) (int, error) {
+	f.lastID++
+	msg := fakeMessage{ChatID: chatID, MessageID: f.lastID, Text: caption}
+	f.messages[msg.MessageID] = &msg
+	f.audio = append(f.audio, msg)
+	return msg.MessageID, nil
+}
+
+func (f *fakeMessenger) SendDocument(chatID int64, file tgbotapi.RequestFileData, caption string) (int, error) {
+	f.lastID++
+	doc := fakeDocument{ChatID: chatID, Caption: caption}
+	if data, ok := file.(tgbotapi.FileBytes); ok {
+		doc.Name, doc.Bytes = data.Name, data.Bytes
+	}
+	f.messages[f.lastID] = &fakeMessage{ChatID: chatID, MessageID: f.lastID, Text: caption}
+	f.documents = append(f.documents, doc)
+	return f.lastID, nil
+}
+
+func (f *fakeMessenger) SetCommands(scope tgbotapi.BotCommandScope, commands []tgbotapi.BotCommand) error {
+	f.menus[menuKey(scope)] = commands
+	return nil
+}
+
+func (f *fakeMessenger) SendQuiz(chatID int64, question string, options []string, correct int, openPeriod time.Duration) (int, string, error) {
+	f.lastID++
+	poll := fakePoll{ChatID: chatID, MessageID: f.lastID, ID: fmt.Sprintf("poll%d", f.lastID),
+		Question: question, Options: options, Correct: correct, Period: openPeriod}
+	f.messages[poll.MessageID] = &fakeMessage{ChatID: chatID, MessageID: poll.MessageID, Text: question}
+	f.polls = append(f.polls, poll)
+	return poll.MessageID, poll.ID, nil
+}
+
+func (f *fakeMessenger) StopPoll(chatID int64, messageID int) error {
+	for i := range f.polls {
+		if f.polls[i].MessageID == messageID {
+			f.polls[i].Closed = true
+		}
+	}
+	return nil
+}
+
+// ключ меню в fakeMessenger: "default" или "chat:<id>"
+func menuKey(scope tgbotapi.BotCommandScope) string {
+	if scope.Type == "chat" {
+		return fmt.Sprintf("chat:%d", scope.ChatID)
+	}
+	return scope.Type
+}
+
+// lastSent возвращает последнее отправленное (не отредактированное) сообщение
+func (f *fakeMessenger) lastSent(t *testing.T) *fakeMessage {
+	t.Helper()
+	if len(f.sent) == 0 {
+		t.Fatal("бот не отправил ни одного сообщения")
+	}
+	return f.messages[f.sent[len(f.sent)-1].MessageID]
+}
+
+// lastSentTo возвращает последнее сообщение, отправленное в чат chatID
+func (f *fakeMessenger) lastSentTo(t *testing.T, chatID int64) *fakeMessage {
+	t.Helper()
+	for i := len(f.sent) - 1; i >= 0; i-- {
+		if f.sent[i].ChatID == chatID {
+			return f.messages[f.sent[i].MessageID]
+		}
+	}
+	t.Fatalf("бот не отправил сообщений в чат %d", chatID)
+	return nil
+}
+
+// buttons возвращает inline-кнопки сообщения в порядке отображения
+func (msg *fakeMessage) buttons() []tgbotapi.InlineKeyboardButton {
+	markup, ok := msg.Markup.(*tgbotapi.InlineKeyboardMarkup)
+	if !ok {
+		if value, isValue := msg.Markup.(tgbotapi.InlineKeyboardMarkup); isValue {
+			markup = &value
+		} else {
+			return nil
+		}
+	}
+	var buttons []tgbotapi.InlineKeyboardButton
+	for _, row := range markup.InlineKeyboard {
+		buttons = append(buttons, row...)
+	}
+	return buttons
+}
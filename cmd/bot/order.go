@@ -0,0 +1,212 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"hash/fnv"
+	"log"
+	"sort"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Режим «порядок слов»: части предложения (слово вместе с аффиксами, как
+// в режиме ввода words) показываются кнопками вперемешку, ученик нажимает их
+// по порядку. Ключ ответа — seq_num: верна часть, которая идёт следующей.
+// Новых данных не нужно — режим доступен в любом упражнении.
+
+// Режимы практики попытки (ExerciseSession.practice)
+const (
+	PracticeSentence = ""      // сборка перевода из вариантов или вводом
+	PracticeOrder    = "order" // порядок слов
+)
+
+// orderSession — активная попытка в режиме «порядок слов»
+type orderSession struct {
+	SubQuestionID int64 // первый подвопрос части, которую ждём
+	MessageID     int
+	Direction     string
+}
+
+// попытка ученика в режиме «порядок слов» с этим nonce; nil — не активна
+func loadOrderSession(userID int64, nonce uint32) *orderSession {
+	db := openDB()
+	defer db.Close()
+
+	var s orderSession
+	err := db.QueryRow(`SELECT sub_question_id, message_id, direction
+		FROM ExerciseSession
+		WHERE user_id = ? AND nonce = ?
+		  AND practice = ?
+		  AND finished_at IS NULL
+		  AND sub_question_id IS NOT NULL`, userID, nonce, PracticeOrder).
+		Scan(&s.SubQuestionID, &s.MessageID, &s.Direction)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return &s
+}
+
+// orderQuestion — вопрос в режиме «порядок слов»
+type orderQuestion struct {
+	Item   Item
+	Subs   []subQuestionRow
+	Chunks [][2]int // части предложения: диапазоны подвопросов
+	Next   int      // индекс части, которую ждём
+}
+
+// разбить вопрос на части; next — часть, начинающаяся с подвопроса subQuestionID
+func newOrderQuestion(item Item, subs []subQuestionRow, subQuestionID int64) *orderQuestion {
+	q := &orderQuestion{Item: item, Subs: subs, Chunks: typedChunks(subs, AnswerWords)}
+	for i, chunk := range q.Chunks {
+		if subs[chunk[0]].ID == subQuestionID {
+			q.Next = i
+		}
+	}
+	q.Item.Word, q.Item.Words = q.Next+1, len(q.Chunks)
+	return q
+}
+
+// загрузить вопрос, на который отвечает ученик
+func loadOrderQuestion(userID int64, nonce uint32, session *orderSession) *orderQuestion {
+	db := openDB()
+	defer db.Close()
+
+	item := Item{Direction: session.Direction, Script: userScript(userID)}
+	err := db.QueryRow(`SELECT q.id, q.text FROM SubQuestion sq JOIN Question q ON q.id = sq.question_id WHERE sq.id = ?`,
+		session.SubQuestionID).Scan(&item.QuestionID, &item.Question)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if session.Direction == DirectionReverse {
+		item.Question = tatarSentence(db, item.QuestionID)
+	}
+	item.Number, item.Total = sessionQuestionPosition(db, userID, nonce, item.QuestionID)
+	return newOrderQuestion(item, loadSubQuestions(db, item.QuestionID, session.Direction), session.SubQuestionID)
+}
+
+// текст части предложения
+func (q *orderQuestion) label(chunk [2]int) string {
+	return renderAnswerField(q.Subs[chunk[0]:chunk[1]])
+}
+
+// собранная часть предложения
+func (q *orderQuestion) field() string {
+	if q.Next >= len(q.Chunks) {
+		return renderAnswerField(q.Subs)
+	}
+	return renderAnswerField(q.Subs[:q.Chunks[q.Next][0]])
+}
+
+// текст вопроса; done — предложение собрано
+func (q *orderQuestion) text(done bool) string {
+	text := questionText(q.Item, q.field(), done)
+	if done {
+		return text
+	}
+	return text + "\n\n🔀 Нажимайте части предложения по порядку"
+}
+
+// кнопки оставшихся частей вперемешку; часть wrongID отмечается ❌.
+// Порядок зависит только от nonce, поэтому не меняется между нажатиями
+func (q *orderQuestion) keyboard(nonce uint32, wrongID int64) *tgbotapi.InlineKeyboardMarkup {
+	remaining := append([][2]int(nil), q.Chunks[q.Next:]...)
+	sort.SliceStable(remaining, func(i, j int) bool {
+		return shuffleKey(nonce, q.Subs[remaining[i][0]].ID) < shuffleKey(nonce, q.Subs[remaining[j][0]].ID)
+	})
+
+	script := q.Item.optionScript()
+	var buttons []tgbotapi.InlineKeyboardButton
+	for _, chunk := range remaining {
+		id := q.Subs[chunk[0]].ID
+		label := script.tatar(q.label(chunk))
+		if id == wrongID {
+			label = "❌ " + label
+		}
+		buttons = append(buttons, callbackButton(label, ActionOrderPick, nonce, id))
+	}
+	markup := tgbotapi.NewInlineKeyboardMarkup(optionsLayout.rows(buttons)...)
+	return &markup
+}
+
+// детерминированный ключ перемешивания кнопок попытки
+func shuffleKey(nonce uint32, id int64) uint32 {
+	h := fnv.New32a()
+	var buf [12]byte
+	binary.BigEndian.PutUint32(buf[:4], nonce)
+	binary.BigEndian.PutUint64(buf[4:], uint64(id))
+	h.Write(buf[:])
+	return h.Sum32()
+}
+
+// отправить вопрос в режиме «порядок слов»
+func sendOrderQuestion(m Messenger, chatID int64, userID int64, nonce uint32, item Item) {
+	db := openDB()
+	subs := loadSubQuestions(db, item.QuestionID, item.Direction)
+	db.Close()
+
+	q := newOrderQuestion(item, subs, item.AnswerID)
+	messageID, err := m.SendHTML(chatID, q.text(false), q.keyboard(nonce, 0))
+	if err != nil {
+		log.Printf("Ошибка отправки вопроса: %v", err)
+	}
+	setTypedPosition(userID, nonce, item.AnswerID, messageID)
+}
+
+// обработать нажатие части предложения; текст — ответ на нажатие
+func handleOrderPick(m Messenger, query *tgbotapi.CallbackQuery, cb Callback) string {
+	userID, chatID := query.From.ID, query.Message.Chat.ID
+	session := loadOrderSession(userID, cb.Nonce)
+	if session == nil || session.MessageID != query.Message.MessageID {
+		log.Printf("Часть предложения не из текущей сессии пользователя %d", userID)
+		return "Это упражнение уже неактивно. Откройте его заново"
+	}
+	q := loadOrderQuestion(userID, cb.Nonce, session)
+	picked := -1
+	for i := q.Next; i < len(q.Chunks); i++ {
+		if q.Subs[q.Chunks[i][0]].ID == cb.IDs[0] {
+			picked = i
+		}
+	}
+	if picked < 0 {
+		return "Эта часть уже на месте"
+	}
+
+	// одинаковые части (например, повторённое слово) взаимозаменяемы
+	expected := q.Chunks[q.Next]
+	isRight := q.Subs[q.Chunks[picked][0]].SeqNum == q.Subs[expected[0]].SeqNum ||
+		q.label(q.Chunks[picked]) == q.label(expected)
+	recordTypedAnswer(userID, cb.Nonce, session.SubQuestionID, q.label(q.Chunks[picked]), isRight, false)
+	if !isRight {
+		m.EditHTML(chatID, session.MessageID, q.text(false), q.keyboard(cb.Nonce, cb.IDs[0]))
+		return "Не та часть — попробуйте другую"
+	}
+
+	q.Next++
+	q.Item.Word = q.Next + 1
+	if q.Next < len(q.Chunks) {
+		setTypedPosition(userID, cb.Nonce, q.Subs[q.Chunks[q.Next][0]].ID, session.MessageID)
+		m.EditHTML(chatID, session.MessageID, q.text(false), q.keyboard(cb.Nonce, 0))
+		return "Верно"
+	}
+
+	// предложение собрано
+	m.EditHTML(chatID, session.MessageID, q.text(true), nil)
+	db := openDB()
+	nextQuestionID, ok := nextPlannedQuestion(db, userID, cb.Nonce, q.Item.QuestionID)
+	db.Close()
+	if !ok {
+		exerciseID := finishSession(userID, cb.Nonce)
+		afterExerciseFinished(m, query.Message, userID, exerciseID)
+		return "Верно"
+	}
+	nextItem := LoadItem(nextQuestionID, session.Direction)
+	nextItem.Number, nextItem.Total = q.Item.Number+1, q.Item.Total
+	nextItem.Script = q.Item.Script
+	markQuestionSeen(userID, nextQuestionID)
+	sendOrderQuestion(m, chatID, userID, cb.Nonce, nextItem)
+	return "Верно"
+}
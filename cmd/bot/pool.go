@@ -0,0 +1,126 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Каждая попытка упражнения проходит по плану вопросов (SessionQuestion).
+// Обычное упражнение — все вопросы по порядку. Если у упражнения задан
+// question_count = N, в план попадают N случайных вопросов из пула без
+// повторов; в первую очередь — те, которые ученик видел реже всего.
+// В обратном направлении в план попадают только вопросы с русской разбивкой.
+
+// составить план вопросов для сессии и вернуть id вопросов по порядку
+func planSessionQuestions(userID int64, nonce uint32, exerciseID int64, direction string) []int64 {
+	db := openDB()
+	defer db.Close()
+
+	var count int
+	if err := db.QueryRow(`SELECT question_count FROM Exercise WHERE id = ?`, exerciseID).Scan(&count); err != nil {
+		log.Fatal(err)
+	}
+
+	query := `SELECT q.id FROM Question q
+		WHERE q.exercise_id = ?
+		  AND EXISTS (SELECT 1 FROM SubQuestion sq WHERE sq.question_id = q.id AND sq.direction = ? AND sq.pointing = 0)
+		ORDER BY q.id`
+	args := []interface{}{exerciseID, direction}
+	if count > 0 {
+		query = `SELECT q.id FROM Question q
+			LEFT JOIN SeenQuestion s ON s.question_id = q.id AND s.user_id = ?
+			WHERE q.exercise_id = ?
+			  AND EXISTS (SELECT 1 FROM SubQuestion sq WHERE sq.question_id = q.id AND sq.direction = ? AND sq.pointing = 0)
+			ORDER BY COALESCE(s.seen_count, 0), RANDOM()
+			LIMIT ?`
+		args = []interface{}{userID, exerciseID, direction, count}
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var plan []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			log.Fatal(err)
+		}
+		plan = append(plan, id)
+	}
+	rows.Close()
+
+	saveSessionPlan(db, userID, nonce, plan)
+	return plan
+}
+
+// сохранить план вопросов попытки
+func saveSessionPlan(db *sql.DB, userID int64, nonce uint32, plan []int64) {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer tx.Rollback()
+	// планы прошлых попыток больше не нужны: их кнопки уже недействительны
+	if _, err := tx.Exec(`DELETE FROM SessionQuestion WHERE user_id = ?`, userID); err != nil {
+		log.Fatal(err)
+	}
+	for i, questionID := range plan {
+		if _, err := tx.Exec(`INSERT INTO SessionQuestion (user_id, nonce, position, question_id) VALUES (?, ?, ?, ?)`,
+			userID, nonce, i+1, questionID); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// следующий вопрос плана попытки после questionID; false — вопросов больше нет
+func nextPlannedQuestion(db *sql.DB, userID int64, nonce uint32, questionID int64) (int64, bool) {
+	var nextQuestionID int64
+	err := db.QueryRow(`SELECT nxt.question_id
+		FROM SessionQuestion cur
+		JOIN SessionQuestion nxt
+			ON nxt.user_id = cur.user_id
+		   AND nxt.nonce = cur.nonce
+		   AND nxt.position = cur.position + 1
+		WHERE cur.user_id = ? AND cur.nonce = ? AND cur.question_id = ?`,
+		userID, nonce, questionID).Scan(&nextQuestionID)
+	if err == sql.ErrNoRows {
+		return 0, false
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return nextQuestionID, true
+}
+
+// номер вопроса в плане попытки и число вопросов в ней
+func sessionQuestionPosition(db *sql.DB, userID int64, nonce uint32, questionID int64) (int, int) {
+	var position, total int
+	err := db.QueryRow(`SELECT
+			COALESCE((SELECT position FROM SessionQuestion WHERE user_id = ? AND nonce = ? AND question_id = ?), 0),
+			(SELECT COUNT(*) FROM SessionQuestion WHERE user_id = ? AND nonce = ?)`,
+		userID, nonce, questionID, userID, nonce).Scan(&position, &total)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return position, total
+}
+
+// запомнить, что ученик увидел вопрос
+func markQuestionSeen(userID int64, questionID int64) {
+	db := openDB()
+	defer db.Close()
+
+	_, err := db.Exec(`INSERT INTO SeenQuestion (user_id, question_id, seen_count, last_seen_at) VALUES (?, ?, 1, ?)
+		ON CONFLICT(user_id, question_id) DO UPDATE SET
+			seen_count = seen_count + 1,
+			last_seen_at = excluded.last_seen_at`,
+		userID, questionID, time.Now().Unix())
+	if err != nil {
+		log.Fatal(err)
+	}
+}
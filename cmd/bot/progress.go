@@ -0,0 +1,63 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// записать ответ ученика в текущей сессии
+func recordAnswer(userID int64, nonce uint32, subQuestionID int64, optionID int64, isRight bool) {
+	db := openDB()
+	defer db.Close()
+
+	_, err := db.Exec(`INSERT INTO AnswerEvent (user_id, exercise_id, nonce, sub_question_id, option_id, is_right, created_at)
+		SELECT s.user_id, s.exercise_id, s.nonce, ?, ?, ?, ?
+		FROM ExerciseSession s
+		WHERE s.user_id = ? AND s.nonce = ?`,
+		subQuestionID, optionID, isRight, time.Now().Unix(), userID, nonce)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// завершить сессию упражнения и сохранить итог попытки; возвращает id упражнения
+func finishSession(userID int64, nonce uint32) int64 {
+	db := openDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	var exerciseID int64
+	err = tx.QueryRow(`SELECT exercise_id FROM ExerciseSession WHERE user_id = ? AND nonce = ?`,
+		userID, nonce).Scan(&exerciseID)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	now := time.Now().Unix()
+	res, err := tx.Exec(`UPDATE ExerciseSession SET finished_at = ?
+		WHERE user_id = ? AND nonce = ? AND finished_at IS NULL`, now, userID, nonce)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return exerciseID // сессия уже завершена
+	}
+	_, err = tx.Exec(`INSERT INTO ExerciseResult (user_id, exercise_id, nonce, started_at, finished_at, answers, right_answers)
+		SELECT s.user_id, s.exercise_id, s.nonce, s.started_at, ?,
+			(SELECT COUNT(*) FROM AnswerEvent a WHERE a.user_id = s.user_id AND a.nonce = s.nonce),
+			(SELECT COUNT(*) FROM AnswerEvent a WHERE a.user_id = s.user_id AND a.nonce = s.nonce AND a.is_right = 1)
+		FROM ExerciseSession s
+		WHERE s.user_id = ? AND s.nonce = ?`, now, userID, nonce)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatal(err)
+	}
+	return exerciseID
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Викторина для групповых чатов: в группе inline-клавиатура общая для всех,
+// поэтому каждый подвопрос упражнения отправляется отдельным опросом-викториной
+// Telegram с теми же вариантами (Option). Ответы приходят обновлениями
+// poll_answer. Опросы открыты quizRoundPeriod, после чего Telegram закрывает
+// их сам, а главный цикл публикует итоги раунда; /quiz stop подводит итоги раньше.
+// Ответы записываются и в AnswerEvent с nonce = 0 — вне сессий упражнения.
+
+// ограничения Telegram и размер раунда
+const (
+	quizMaxPolls    = 10  // опросов в раунде
+	quizMaxOptions  = 10  // вариантов в опросе
+	quizMaxQuestion = 300 // символов в вопросе опроса
+	quizMaxOption   = 100 // символов в варианте
+)
+
+// сколько открыты опросы раунда (open_period, не больше 10 минут)
+const quizRoundPeriod = 10 * time.Minute
+
+// quizPoll — опрос, собранный из подвопроса
+type quizPoll struct {
+	SubQuestionID int64
+	Question      string
+	Options       []string
+	OptionIDs     []int64
+	Correct       int
+}
+
+// Обработчик команды /quiz <id упражнения> и /quiz stop
+func handleQuizCommand(m Messenger, msg *tgbotapi.Message) {
+	if !msg.Chat.IsGroup() && !msg.Chat.IsSuperGroup() {
+		sendMessage(m, msg.Chat.ID, "Викторина проводится в групповом чате: добавьте бота в группу и отправьте там /quiz <id упражнения>")
+		return
+	}
+	arg := strings.TrimSpace(msg.CommandArguments())
+	if strings.EqualFold(arg, "stop") || arg == "стоп" {
+		if !finishQuizRound(m, msg.Chat.ID) {
+			sendMessage(m, msg.Chat.ID, "Сейчас викторина не идёт")
+		}
+		return
+	}
+	exerciseID, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		sendMessage(m, msg.Chat.ID, "Формат: /quiz <id упражнения> — начать, /quiz stop — подвести итоги")
+		return
+	}
+	startQuizRound(m, msg.Chat.ID, exerciseID)
+}
+
+// начать раунд: закрыть предыдущий и отправить опросы
+func startQuizRound(m Messenger, chatID int64, exerciseID int64) {
+	db := openDB()
+	var title string
+	err := db.QueryRow(`SELECT title FROM Exercise WHERE id = ?`, exerciseID).Scan(&title)
+	if err == sql.ErrNoRows {
+		db.Close()
+		sendMessage(m, chatID, "Упражнение не найдено")
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	polls := buildQuizPolls(db, exerciseID)
+	db.Close()
+	if len(polls) == 0 {
+		sendMessage(m, chatID, "В этом упражнении нет вопросов с вариантами для викторины")
+		return
+	}
+
+	finishQuizRound(m, chatID)
+	roundID := createQuizRound(chatID, exerciseID)
+	sendMessage(m, chatID, fmt.Sprintf("🎯 Викторина «%s»: %d вопросов. Отвечайте в опросах: через %d мин они закроются и придут итоги, подвести их раньше — /quiz stop",
+		title, len(polls), int(quizRoundPeriod/time.Minute)))
+	for i, poll := range polls {
+		messageID, pollID, err := m.SendQuiz(chatID, poll.Question, poll.Options, poll.Correct, quizRoundPeriod)
+		if err != nil {
+			log.Printf("Ошибка отправки опроса: %v", err)
+			continue
+		}
+		saveQuizPoll(roundID, i+1, poll, messageID, pollID)
+	}
+}
+
+// опросы раунда: подвопросы с вариантами из вопросов упражнения
+func buildQuizPolls(db *sql.DB, exerciseID int64) []quizPoll {
+	var count int
+	var typeName string
+	if err := db.QueryRow(`SELECT question_count, type FROM Exercise WHERE id = ?`, exerciseID).Scan(&count, &typeName); err != nil {
+		log.Fatal(err)
+	}
+	query := `SELECT id, text FROM Question WHERE exercise_id = ? ORDER BY id`
+	if count > 0 {
+		query = `SELECT id, text FROM Question WHERE exercise_id = ? ORDER BY RANDOM() LIMIT ` + strconv.Itoa(count)
+	}
+	rows, err := db.Query(query, exerciseID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	type question struct {
+		ID   int64
+		Text string
+	}
+	var questions []question
+	for rows.Next() {
+		var q question
+		if err := rows.Scan(&q.ID, &q.Text); err != nil {
+			log.Fatal(err)
+		}
+		questions = append(questions, q)
+	}
+	rows.Close()
+
+	var polls []quizPoll
+	for _, q := range questions {
+		subs := loadSubQuestions(db, q.ID, DirectionForward)
+		for i := nextAnswerable(subs, 0); i < len(subs) && len(polls) < quizMaxPolls; i = nextAnswerable(subs, i+1) {
+			poll, ok := newQuizPoll(db, subs[i], quizQuestionText(q.Text, typeName, subs, i))
+			if ok {
+				polls = append(polls, poll)
+			}
+		}
+	}
+	return polls
+}
+
+// текст опроса: задание и собранная до подвопроса часть
+func quizQuestionText(question string, typeName string, subs []subQuestionRow, idx int) string {
+	var text string
+	switch {
+	case subs[idx].Prompt != "":
+		text = question + "\n" + subs[idx].Prompt + " — ?"
+	case typeName == TypeChoice:
+		text = question
+	default:
+		text = "Переведите: " + question + "\n" + strings.TrimSpace(renderAnswerField(subs[:idx])+" …")
+	}
+	return truncateRunes(text, quizMaxQuestion)
+}
+
+// опрос из вариантов подвопроса; false — вариантов меньше двух или нет верного
+func newQuizPoll(db *sql.DB, sub subQuestionRow, question string) (quizPoll, bool) {
+	rows, err := db.Query(`SELECT id, text FROM Option WHERE sub_question_id = ? ORDER BY id`, sub.ID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+
+	poll := quizPoll{SubQuestionID: sub.ID, Question: question, Correct: -1}
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var id int64
+		var text string
+		if err := rows.Scan(&id, &text); err != nil {
+			log.Fatal(err)
+		}
+		if seen[text] {
+			continue // Telegram не различает одинаковые варианты
+		}
+		seen[text] = true
+		poll.OptionIDs = append(poll.OptionIDs, id)
+		poll.Options = append(poll.Options, truncateRunes(text, quizMaxOption))
+	}
+	rand.Shuffle(len(poll.Options), func(i, j int) {
+		poll.Options[i], poll.Options[j] = poll.Options[j], poll.Options[i]
+		poll.OptionIDs[i], poll.OptionIDs[j] = poll.OptionIDs[j], poll.OptionIDs[i]
+	})
+	for i, text := range poll.Options {
+		if text == truncateRunes(sub.Text, quizMaxOption) {
+			poll.Correct = i
+		}
+	}
+	// лишние варианты отбрасываются, верный остаётся
+	if len(poll.Options) > quizMaxOptions && poll.Correct >= quizMaxOptions {
+		last := quizMaxOptions - 1
+		poll.Options[last], poll.Options[poll.Correct] = poll.Options[poll.Correct], poll.Options[last]
+		poll.OptionIDs[last], poll.OptionIDs[poll.Correct] = poll.OptionIDs[poll.Correct], poll.OptionIDs[last]
+		poll.Correct = last
+	}
+	if len(poll.Options) > quizMaxOptions {
+		poll.Options, poll.OptionIDs = poll.Options[:quizMaxOptions], poll.OptionIDs[:quizMaxOptions]
+	}
+	return poll, poll.Correct >= 0 && len(poll.Options) >= 2
+}
+
+// обрезать текст до limit символов
+func truncateRunes(text string, limit int) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	return string([]rune(text)[:limit-1]) + "…"
+}
+
+func createQuizRound(chatID int64, exerciseID int64) int64 {
+	db := openDB()
+	defer db.Close()
+
+	res, err := db.Exec(`INSERT INTO QuizRound (chat_id, exercise_id, started_at) VALUES (?, ?, ?)`,
+		chatID, exerciseID, time.Now().Unix())
+	if err != nil {
+		log.Fatal(err)
+	}
+	roundID, err := res.LastInsertId()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return roundID
+}
+
+func saveQuizPoll(roundID int64, position int, poll quizPoll, messageID int, pollID string) {
+	db := openDB()
+	defer db.Close()
+
+	ids := make([]string, len(poll.OptionIDs))
+	for i, id := range poll.OptionIDs {
+		ids[i] = strconv.FormatInt(id, 10)
+	}
+	_, err := db.Exec(`INSERT INTO QuizPoll (poll_id, round_id, position, sub_question_id, message_id, correct_option, option_ids)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		pollID, roundID, position, poll.SubQuestionID, messageID, poll.Correct, strings.Join(ids, ","))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// обработать ответ участника на опрос; учитывается первый ответ
+func handlePollAnswer(answer *tgbotapi.PollAnswer) {
+	if len(answer.OptionIDs) == 0 {
+		return
+	}
+	rememberUser(&answer.User)
+
+	db := openDB()
+	defer db.Close()
+
+	var exerciseID, subQuestionID int64
+	var correct int
+	var optionIDs string
+	err := db.QueryRow(`SELECT r.exercise_id, p.sub_question_id, p.correct_option, p.option_ids
+		FROM QuizPoll p
+		JOIN QuizRound r ON r.id = p.round_id
+		WHERE p.poll_id = ? AND r.finished_at IS NULL`, answer.PollID).
+		Scan(&exerciseID, &subQuestionID, &correct, &optionIDs)
+	if err == sql.ErrNoRows {
+		return // чужой опрос или раунд уже закончен
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	chosen := answer.OptionIDs[0]
+	isRight := chosen == correct
+	now := time.Now().Unix()
+	res, err := db.Exec(`INSERT OR IGNORE INTO QuizAnswer (poll_id, user_id, option_index, is_right, created_at) VALUES (?, ?, ?, ?, ?)`,
+		answer.PollID, answer.User.ID, chosen, isRight, now)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+	ids := strings.Split(optionIDs, ",")
+	if chosen < 0 || chosen >= len(ids) {
+		return
+	}
+	optionID, _ := strconv.ParseInt(ids[chosen], 10, 64)
+	_, err = db.Exec(`INSERT INTO AnswerEvent (user_id, exercise_id, nonce, sub_question_id, option_id, is_right, created_at)
+		VALUES (?, ?, 0, ?, ?, ?, ?)`, answer.User.ID, exerciseID, subQuestionID, optionID, isRight, now)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// quizScore — строка таблицы результатов
+type quizScore struct {
+	UserID int64
+	Name   string
+	Right  int
+}
+
+// закрыть текущий раунд чата и опубликовать итоги; false — раунда нет
+func finishQuizRound(m Messenger, chatID int64) bool {
+	db := openDB()
+	defer db.Close()
+
+	var roundID, startedAt int64
+	var title string
+	err := db.QueryRow(`SELECT r.id, r.started_at, e.title
+		FROM QuizRound r
+		JOIN Exercise e ON e.id = r.exercise_id
+		WHERE r.chat_id = ? AND r.finished_at IS NULL
+		ORDER BY r.id DESC LIMIT 1`, chatID).Scan(&roundID, &startedAt, &title)
+	if err == sql.ErrNoRows {
+		return false
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE QuizRound SET finished_at = ? WHERE chat_id = ? AND finished_at IS NULL`,
+		time.Now().Unix(), chatID); err != nil {
+		log.Fatal(err)
+	}
+
+	var messageIDs []int
+	rows, err := db.Query(`SELECT message_id FROM QuizPoll WHERE round_id = ? ORDER BY position`, roundID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			log.Fatal(err)
+		}
+		messageIDs = append(messageIDs, id)
+	}
+	rows.Close()
+	// по истечении open_period Telegram уже закрыл опросы сам
+	if time.Since(time.Unix(startedAt, 0)) < quizRoundPeriod {
+		for _, id := range messageIDs {
+			if err := m.StopPoll(chatID, id); err != nil {
+				log.Printf("Ошибка закрытия опроса: %v", err)
+			}
+		}
+	}
+
+	scores := quizScores(db, roundID)
+	sendMessage(m, chatID, quizLeaderboard(title, len(messageIDs), scores))
+	return true
+}
+
+// подвести итоги раундов, опросы которых уже закрылись
+func finishExpiredQuizRounds(m Messenger) {
+	db := openDB()
+	rows, err := db.Query(`SELECT DISTINCT chat_id FROM QuizRound WHERE finished_at IS NULL AND started_at <= ?`,
+		time.Now().Add(-quizRoundPeriod).Unix())
+	if err != nil {
+		log.Fatal(err)
+	}
+	var chats []int64
+	for rows.Next() {
+		var chatID int64
+		if err := rows.Scan(&chatID); err != nil {
+			log.Fatal(err)
+		}
+		chats = append(chats, chatID)
+	}
+	rows.Close()
+	db.Close()
+
+	for _, chatID := range chats {
+		finishQuizRound(m, chatID)
+	}
+}
+
+// результаты участников: больше верных ответов, при равенстве — кто ответил раньше
+func quizScores(db *sql.DB, roundID int64) []quizScore {
+	rows, err := db.Query(`SELECT a.user_id, SUM(a.is_right)
+		FROM QuizAnswer a
+		JOIN QuizPoll p ON p.poll_id = a.poll_id
+		WHERE p.round_id = ?
+		GROUP BY a.user_id
+		ORDER BY SUM(a.is_right) DESC, MAX(a.created_at), a.user_id`, roundID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var scores []quizScore
+	for rows.Next() {
+		var s quizScore
+		if err := rows.Scan(&s.UserID, &s.Right); err != nil {
+			log.Fatal(err)
+		}
+		scores = append(scores, s)
+	}
+	rows.Close()
+	for i := range scores {
+		scores[i].Name = userName(db, scores[i].UserID)
+	}
+	return scores
+}
+
+// текст таблицы результатов раунда
+func quizLeaderboard(title string, total int, scores []quizScore) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("🏁 Итоги викторины «%s»", title))
+	if len(scores) == 0 {
+		text.WriteString("\nНикто не ответил")
+		return text.String()
+	}
+	medals := []string{"🥇", "🥈", "🥉"}
+	for i, s := range scores {
+		place := fmt.Sprintf("%d.", i+1)
+		if i < len(medals) {
+			place = medals[i]
+		}
+		text.WriteString(fmt.Sprintf("\n%s %s — %d/%d", place, s.Name, s.Right, total))
+	}
+	return text.String()
+}
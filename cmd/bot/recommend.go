@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Рекомендация следующего упражнения. Точность считается по последним
+// попыткам ученика: высокая — ведём к упражнениям сложнее (следующий
+// уровень, а без уровней — дальше по списку), низкая — возвращаем
+// к пройденному упражнению с худшей точностью. Давно не повторявшиеся
+// упражнения с неидеальной точностью тоже предлагаются на повторение.
+
+// recommender — пороги выбора; значения по умолчанию в defaultRecommender
+type recommender struct {
+	AdvanceFrom   int           // точность, с которой предлагаем сложнее, %
+	ReviewBelow   int           // точность, ниже которой предлагаем повторение, %
+	StaleAfter    time.Duration // через сколько пройденное упражнение забывается
+	RecentResults int           // по скольким последним попыткам считать точность
+}
+
+var defaultRecommender = recommender{
+	AdvanceFrom:   85,
+	ReviewBelow:   70,
+	StaleAfter:    14 * 24 * time.Hour,
+	RecentResults: 5,
+}
+
+// exerciseHistory — упражнение из списка и последняя попытка ученика в нём
+type exerciseHistory struct {
+	exerciseEntry
+	Accuracy   int       // точность последней завершённой попытки, %
+	LastPlayed time.Time // время последней завершённой попытки
+}
+
+// learnerStats — всё, на чём основана рекомендация
+type learnerStats struct {
+	Exercises     []exerciseHistory // в порядке списка упражнений
+	RecentAnswers int               // ответов в последних попытках
+	RecentRight   int               // из них верных
+}
+
+// точность последних попыток, %
+func (s learnerStats) accuracy() int {
+	if s.RecentAnswers == 0 {
+		return 0
+	}
+	return s.RecentRight * 100 / s.RecentAnswers
+}
+
+// recommendation — выбранное упражнение и объяснение выбора
+type recommendation struct {
+	ExerciseID int64
+	Title      string
+	Reason     string
+}
+
+// pick выбирает упражнение; false — рекомендовать нечего (в том числе
+// ученику без завершённых попыток)
+func (r recommender) pick(stats learnerStats, now time.Time) (recommendation, bool) {
+	var open, done []exerciseHistory
+	frontier := -1 // последнее пройденное упражнение в порядке списка
+	for i, e := range stats.Exercises {
+		if e.Status == statusDone {
+			done = append(done, e)
+			frontier = i
+		}
+		if !e.Locked && e.Status != statusDone {
+			open = append(open, e)
+		}
+	}
+	choose := func(e exerciseHistory, reason string, args ...interface{}) (recommendation, bool) {
+		return recommendation{ExerciseID: e.ID, Title: e.Title, Reason: fmt.Sprintf(reason, args...)}, true
+	}
+
+	if stats.RecentAnswers == 0 {
+		return recommendation{}, false // новичку хватает порядка списка
+	}
+
+	accuracy := stats.accuracy()
+	if accuracy < r.ReviewBelow && len(done) > 0 {
+		e := weakest(done)
+		return choose(e, "Точность последних попыток %d%% — ниже %d%%, повторите упражнение, где в прошлый раз было %d%%",
+			accuracy, r.ReviewBelow, e.Accuracy)
+	}
+
+	var stale []exerciseHistory
+	for _, e := range done {
+		if e.Accuracy < r.AdvanceFrom && now.Sub(e.LastPlayed) >= r.StaleAfter {
+			stale = append(stale, e)
+		}
+	}
+	if len(stale) > 0 {
+		e := weakest(stale)
+		return choose(e, "Упражнение не повторяли %d дн., в прошлый раз точность %d%% — пора освежить",
+			int(now.Sub(e.LastPlayed)/(24*time.Hour)), e.Accuracy)
+	}
+
+	if accuracy >= r.AdvanceFrom && frontier >= 0 {
+		level := stats.Exercises[frontier].Level
+		for _, e := range stats.Exercises[frontier+1:] {
+			if e.Locked || e.Status == statusDone {
+				continue
+			}
+			if level > 0 && e.Level > level {
+				return choose(e, "Точность последних попыток %d%% — можно переходить к уровню %d", accuracy, e.Level)
+			}
+			if level == 0 {
+				return choose(e, "Точность последних попыток %d%% — можно двигаться дальше по списку", accuracy)
+			}
+		}
+	}
+
+	if len(open) > 0 {
+		return choose(open[0], "Точность последних попыток %d%% — продолжайте по порядку", accuracy)
+	}
+	if len(done) > 0 {
+		return choose(weakest(done), "Все доступные упражнения пройдены — повторите то, где точность ниже всего")
+	}
+	return recommendation{}, false
+}
+
+// упражнение с худшей точностью; при равной — давнее
+func weakest(exercises []exerciseHistory) exerciseHistory {
+	best := exercises[0]
+	for _, e := range exercises[1:] {
+		if e.Accuracy < best.Accuracy || e.Accuracy == best.Accuracy && e.LastPlayed.Before(best.LastPlayed) {
+			best = e
+		}
+	}
+	return best
+}
+
+// статистика ученика по упражнениям списка
+func loadLearnerStats(userID int64, entries []exerciseEntry, recentResults int) learnerStats {
+	db := openDB()
+	defer db.Close()
+
+	type lastResult struct {
+		accuracy   int
+		finishedAt int64
+	}
+	last := make(map[int64]lastResult)
+	rows, err := db.Query(`SELECT r.exercise_id, r.answers, r.right_answers, r.finished_at
+		FROM ExerciseResult r
+		WHERE r.user_id = ? AND r.id = (
+			SELECT MAX(id) FROM ExerciseResult WHERE user_id = r.user_id AND exercise_id = r.exercise_id
+		)`, userID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for rows.Next() {
+		var exerciseID, finishedAt int64
+		var answers, right int
+		if err := rows.Scan(&exerciseID, &answers, &right, &finishedAt); err != nil {
+			log.Fatal(err)
+		}
+		result := lastResult{finishedAt: finishedAt}
+		if answers > 0 {
+			result.accuracy = right * 100 / answers
+		}
+		last[exerciseID] = result
+	}
+	rows.Close()
+
+	var stats learnerStats
+	err = db.QueryRow(`SELECT COALESCE(SUM(answers), 0), COALESCE(SUM(right_answers), 0)
+		FROM (SELECT answers, right_answers FROM ExerciseResult WHERE user_id = ? ORDER BY id DESC LIMIT ?)`,
+		userID, recentResults).Scan(&stats.RecentAnswers, &stats.RecentRight)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		h := exerciseHistory{exerciseEntry: entry}
+		if result, ok := last[entry.ID]; ok {
+			h.Accuracy = result.accuracy
+			h.LastPlayed = time.Unix(result.finishedAt, 0)
+		}
+		stats.Exercises = append(stats.Exercises, h)
+	}
+	return stats
+}
+
+// рекомендация для ученика по списку его упражнений
+func recommendExercise(userID int64, entries []exerciseEntry) (recommendation, bool) {
+	stats := loadLearnerStats(userID, entries, defaultRecommender.RecentResults)
+	return defaultRecommender.pick(stats, time.Now())
+}
+
+// Обработчик команды /recommend [id пользователя]: почему выбрано упражнение
+func handleRecommendCommand(m Messenger, msg *tgbotapi.Message) {
+	userID := msg.From.ID
+	if arg := strings.TrimSpace(msg.CommandArguments()); arg != "" {
+		if userRole(msg.From.ID) < RoleTeacher {
+			sendMessage(m, msg.Chat.ID, "Рекомендации других учеников доступны учителю")
+			return
+		}
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			sendMessage(m, msg.Chat.ID, "Формат: /recommend [id пользователя]")
+			return
+		}
+		userID = id
+	}
+
+	r := defaultRecommender
+	entries := loadExerciseEntries(userID)
+	stats := loadLearnerStats(userID, entries, r.RecentResults)
+	done := 0
+	for _, e := range stats.Exercises {
+		if e.Status == statusDone {
+			done++
+		}
+	}
+
+	var text strings.Builder
+	if rec, ok := r.pick(stats, time.Now()); ok {
+		fmt.Fprintf(&text, "⭐ Рекомендуем «%s» (id %d)\nПочему: %s", rec.Title, rec.ExerciseID, rec.Reason)
+	} else if stats.RecentAnswers == 0 {
+		text.WriteString("Рекомендаций пока нет: они появятся после первого пройденного упражнения")
+	} else {
+		text.WriteString("Рекомендовать нечего: нет доступных упражнений")
+	}
+	fmt.Fprintf(&text, "\n\nТочность последних %d попыток: %d%% (%d из %d)", r.RecentResults, stats.accuracy(), stats.RecentRight, stats.RecentAnswers)
+	fmt.Fprintf(&text, "\nПройдено упражнений: %d из %d", done, len(stats.Exercises))
+	fmt.Fprintf(&text, "\nПороги: сложнее — от %d%%, повторение — ниже %d%%, забытые — через %d дн.",
+		r.AdvanceFrom, r.ReviewBelow, int(r.StaleAfter/(24*time.Hour)))
+	sendMessage(m, msg.Chat.ID, text.String())
+}
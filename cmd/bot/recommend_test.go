@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecommenderPick(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local)
+	recent := now.AddDate(0, 0, -1)
+	old := now.AddDate(0, 0, -30)
+
+	// упражнение списка: id, уровень; пройденное — с точностью и датой
+	entry := func(id int64, level int) exerciseHistory {
+		return exerciseHistory{exerciseEntry: exerciseEntry{ID: id, Title: fmt.Sprintf("e%d", id), Level: level}}
+	}
+	done := func(id int64, level int, accuracy int, played time.Time) exerciseHistory {
+		e := entry(id, level)
+		e.Status = statusDone
+		e.Accuracy = accuracy
+		e.LastPlayed = played
+		return e
+	}
+	locked := func(e exerciseHistory) exerciseHistory {
+		e.Locked = true
+		return e
+	}
+
+	tests := []struct {
+		name      string
+		exercises []exerciseHistory
+		right     int // верных из 100 последних ответов
+		want      int64
+		reason    string
+	}{
+		{"новичку нечего советовать", []exerciseHistory{entry(1, 1), entry(2, 1)}, -1, 0, ""},
+		{"высокая точность — следующий уровень",
+			[]exerciseHistory{done(1, 1, 95, recent), entry(2, 1), entry(3, 2)}, 95, 3, "уровню 2"},
+		{"следующий уровень закрыт — по порядку",
+			[]exerciseHistory{done(1, 1, 95, recent), entry(2, 1), locked(entry(3, 2))}, 95, 2, "по порядку"},
+		{"без уровней — дальше по списку",
+			[]exerciseHistory{entry(1, 0), done(2, 0, 90, recent), entry(3, 0)}, 90, 3, "дальше по списку"},
+		{"средняя точность — первое непройденное",
+			[]exerciseHistory{entry(1, 0), done(2, 0, 75, recent), entry(3, 0)}, 75, 1, "по порядку"},
+		{"низкая точность — повторить худшее",
+			[]exerciseHistory{done(1, 1, 60, recent), done(2, 1, 40, recent), entry(3, 2)}, 50, 2, "ниже 70%"},
+		{"при равной точности — давнее",
+			[]exerciseHistory{done(1, 1, 40, recent), done(2, 1, 40, old), entry(3, 2)}, 40, 2, "ниже 70%"},
+		{"забытое неидеальное — освежить",
+			[]exerciseHistory{done(1, 1, 80, old), done(2, 1, 100, old), entry(3, 2)}, 90, 1, "30 дн."},
+		{"забытое идеальное не повторяем",
+			[]exerciseHistory{done(1, 1, 100, old), entry(2, 2)}, 100, 2, "уровню 2"},
+		{"всё пройдено — худшее",
+			[]exerciseHistory{done(1, 1, 90, recent), done(2, 1, 80, recent)}, 85, 2, "Все доступные"},
+		{"ничего не открыто и не пройдено", []exerciseHistory{locked(entry(1, 2))}, 90, 0, ""},
+	}
+	for _, tt := range tests {
+		stats := learnerStats{Exercises: tt.exercises}
+		if tt.right >= 0 {
+			stats.RecentAnswers, stats.RecentRight = 100, tt.right
+		}
+		rec, ok := defaultRecommender.pick(stats, now)
+		if ok != (tt.want != 0) || rec.ExerciseID != tt.want {
+			t.Errorf("%s: выбрано %d (%v), ожидалось %d", tt.name, rec.ExerciseID, ok, tt.want)
+			continue
+		}
+		if !strings.Contains(rec.Reason, tt.reason) {
+			t.Errorf("%s: объяснение %q без %q", tt.name, rec.Reason, tt.reason)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// Сообщения упражнения отправляются с разметкой HTML: русское предложение
+// курсивом, собранный перевод жирным, сверху — прогресс попытки. Весь текст
+// из базы экранируется, чтобы «<» или «&» в упражнении не ломали сообщение.
+// Татарский текст показывается в письменности ученика (item.Script): в прямом
+// направлении это собранный перевод, в обратном — само задание.
+
+// текст нового вопроса с полем для перевода
+func questionPrompt(item Item) string {
+	return questionText(item, item.Lead, false)
+}
+
+// текст вопроса с собранной частью перевода (кириллицей, как в базе);
+// done — вопрос собран целиком
+func questionText(item Item, answerField string, done bool) string {
+	if render := exerciseTypeOf(item.Type).Render; render != nil {
+		return render(item, done)
+	}
+	var text strings.Builder
+	if progress := questionProgress(item, done); progress != "" {
+		text.WriteString(progress + "\n")
+	}
+	header, question := "Переведите предложение:", item.Question
+	if item.Direction == DirectionReverse {
+		header, question = "Переведите на русский:", item.Script.tatar(question)
+	} else {
+		answerField = item.Script.tatar(answerField)
+	}
+	text.WriteString(header + "\n<i>" + html.EscapeString(question) + "</i>\nПеревод:")
+	if answerField != "" {
+		text.WriteString(" <b>" + html.EscapeString(answerField) + "</b>")
+	}
+	if done {
+		text.WriteString(" ✅")
+	}
+	return text.String()
+}
+
+// строка прогресса: «Вопрос 2/10 · слово 3/7»
+func questionProgress(item Item, done bool) string {
+	var parts []string
+	if item.Total > 0 {
+		parts = append(parts, fmt.Sprintf("Вопрос %d/%d", item.Number, item.Total))
+	}
+	if !done && item.Words > 0 {
+		parts = append(parts, fmt.Sprintf("слово %d/%d", item.Word, item.Words))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return capitalize(strings.Join(parts, " · "))
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"LinguisticCombinatorics/internal/report"
+)
+
+const reportUsage = "Формат: /report class <id класса> или /report exercise <id упражнения>"
+
+// Обработчик команды /report: книга Excel по классу или упражнению
+func handleReportCommand(m Messenger, msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) != 2 {
+		sendMessage(m, msg.Chat.ID, reportUsage)
+		return
+	}
+
+	db := openDB()
+	defer db.Close()
+
+	var r *report.Report
+	var err error
+	switch strings.ToLower(args[0]) {
+	case "class", "класс":
+		c, reason := managedClassroom(db, msg.From.ID, args[1])
+		if c == nil {
+			sendMessage(m, msg.Chat.ID, reason)
+			return
+		}
+		r, err = report.ForClassroom(db, c.ID)
+	case "exercise", "упражнение":
+		exerciseID, parseErr := strconv.ParseInt(args[1], 10, 64)
+		if parseErr != nil {
+			sendMessage(m, msg.Chat.ID, "Некорректный id упражнения")
+			return
+		}
+		if !exerciseExists(db, exerciseID) {
+			sendMessage(m, msg.Chat.ID, "Упражнение не найдено")
+			return
+		}
+		// учитель видит только учеников своих классов, администратор — всех
+		var teacherID int64
+		if userRole(msg.From.ID) < RoleAdmin {
+			teacherID = msg.From.ID
+		}
+		r, err = report.ForExercise(db, exerciseID, teacherID)
+		if err == nil && teacherID != 0 && len(r.Rows) == 0 {
+			sendMessage(m, msg.Chat.ID, "Ученики ваших классов в этом упражнении ещё не отвечали")
+			return
+		}
+	default:
+		sendMessage(m, msg.Chat.ID, reportUsage)
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	book, err := r.Workbook()
+	if err != nil {
+		log.Fatal(err)
+	}
+	buf, err := book.WriteToBuffer()
+	if err != nil {
+		log.Fatal(err)
+	}
+	file := tgbotapi.FileBytes{Name: r.FileName(), Bytes: buf.Bytes()}
+	caption := fmt.Sprintf("📊 Отчёт «%s»: выполнение, точность, время, подсказки и частые ошибки", r.Title)
+	if _, err := m.SendDocument(msg.Chat.ID, file, caption); err != nil {
+		log.Printf("Ошибка отправки отчёта: %v", err)
+	}
+}
+
+// Обработчик команды /distractors <id упражнения>: анализ вариантов ответов
+func handleDistractorsCommand(m Messenger, msg *tgbotapi.Message) {
+	exerciseID, err := strconv.ParseInt(strings.TrimSpace(msg.CommandArguments()), 10, 64)
+	if err != nil {
+		sendMessage(m, msg.Chat.ID, "Формат: /distractors <id упражнения>")
+		return
+	}
+	db := openDB()
+	defer db.Close()
+	if !exerciseExists(db, exerciseID) {
+		sendMessage(m, msg.Chat.ID, "Упражнение не найдено")
+		return
+	}
+	title, stats, err := report.Distractors(db, exerciseID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sendLongMessage(m, msg.Chat.ID, report.DistractorText(title, stats))
+}
+
+// ограничение Telegram на длину сообщения
+const maxMessageRunes = 4096
+
+// отправить текст, при необходимости несколькими сообщениями
+func sendLongMessage(m Messenger, chatID int64, text string) {
+	for _, part := range splitMessage(text, maxMessageRunes) {
+		sendMessage(m, chatID, part)
+	}
+}
+
+// разбить текст на сообщения не длиннее limit символов по границам строк
+func splitMessage(text string, limit int) []string {
+	var parts []string
+	var part strings.Builder
+	length := 0
+	for _, line := range strings.Split(text, "\n") {
+		lineLen := utf8.RuneCountInString(line)
+		if length > 0 && length+1+lineLen > limit {
+			parts = append(parts, part.String())
+			part.Reset()
+			length = 0
+		}
+		if length > 0 {
+			part.WriteString("\n")
+			length++
+		}
+		part.WriteString(line)
+		length += lineLen
+	}
+	return append(parts, part.String())
+}
+
+// упражнение есть в базе
+func exerciseExists(db *sql.DB, exerciseID int64) bool {
+	var exists bool
+	if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM Exercise WHERE id = ?)`, exerciseID).Scan(&exists); err != nil {
+		log.Fatal(err)
+	}
+	return exists
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitMessage(t *testing.T) {
+	parts := splitMessage("аа\nбб\nвв\nгггггг", 5)
+	if strings.Join(parts, "|") != "аа\nбб|вв|гггггг" {
+		t.Errorf("части: %q", parts)
+	}
+	if parts := splitMessage("коротко", 100); len(parts) != 1 || parts[0] != "коротко" {
+		t.Errorf("короткий текст: %q", parts)
+	}
+}
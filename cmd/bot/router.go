@@ -0,0 +1,144 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Язык интерфейса по умолчанию
+const defaultLanguage = "ru"
+
+// CommandHandler — обработчик команды бота
+type CommandHandler func(m Messenger, msg *tgbotapi.Message)
+
+// Command — описание команды бота
+type Command struct {
+	Name        string            // команда без слеша
+	Description string            // короткое описание для меню Telegram
+	Role        Role              // минимальная роль, которой доступна команда
+	Help        map[string]string // текст для /help по коду языка
+	Handler     CommandHandler
+}
+
+// CommandRouter хранит команды в порядке регистрации и диспетчеризует их
+type CommandRouter struct {
+	commands []*Command
+	byName   map[string]*Command
+}
+
+func newCommandRouter() *CommandRouter {
+	return &CommandRouter{byName: make(map[string]*Command)}
+}
+
+// Register добавляет команду; повторная регистрация имени — ошибка программиста
+func (r *CommandRouter) Register(cmd Command) {
+	if _, exists := r.byName[cmd.Name]; exists {
+		log.Fatalf("Команда /%s зарегистрирована дважды", cmd.Name)
+	}
+	r.commands = append(r.commands, &cmd)
+	r.byName[cmd.Name] = &cmd
+}
+
+// Available возвращает команды, доступные роли, в порядке регистрации
+func (r *CommandRouter) Available(role Role) []*Command {
+	var available []*Command
+	for _, cmd := range r.commands {
+		if role >= cmd.Role {
+			available = append(available, cmd)
+		}
+	}
+	return available
+}
+
+// Dispatch выполняет команду из сообщения; false — сообщение не команда
+func (r *CommandRouter) Dispatch(m Messenger, msg *tgbotapi.Message) bool {
+	name := msg.Command()
+	if name == "" {
+		return false
+	}
+	cmd, ok := r.byName[name]
+	if !ok {
+		sendMessage(m, msg.Chat.ID, "Неизвестная команда. Попробуй /help")
+		return true
+	}
+	if senderRole(msg) < cmd.Role {
+		sendMessage(m, msg.Chat.ID, "Эта команда тебе недоступна. Попробуй /help")
+		return true
+	}
+	cmd.Handler(m, msg)
+	return true
+}
+
+// роль автора сообщения
+func senderRole(msg *tgbotapi.Message) Role {
+	if msg.From == nil {
+		return RoleStudent
+	}
+	return userRole(msg.From.ID)
+}
+
+// HelpText собирает справку по доступным роли командам на нужном языке
+func (r *CommandRouter) HelpText(role Role, language string) string {
+	language = helpLanguage(language)
+	var b strings.Builder
+	b.WriteString(helpHeader[language])
+	b.WriteString("\n")
+	for _, cmd := range r.Available(role) {
+		text, ok := cmd.Help[language]
+		if !ok {
+			text = cmd.Description
+		}
+		b.WriteString("/" + cmd.Name + " - " + text + "\n")
+	}
+	return b.String()
+}
+
+// BotCommands возвращает меню команд Telegram для роли
+func (r *CommandRouter) BotCommands(role Role) []tgbotapi.BotCommand {
+	var menu []tgbotapi.BotCommand
+	for _, cmd := range r.Available(role) {
+		menu = append(menu, tgbotapi.BotCommand{Command: cmd.Name, Description: cmd.Description})
+	}
+	return menu
+}
+
+var helpHeader = map[string]string{
+	"ru": "Доступные команды:",
+	"tt": "Кулланып була торган командалар:",
+	"en": "Available commands:",
+}
+
+// язык справки по коду языка Telegram; неизвестные языки — русский
+func helpLanguage(code string) string {
+	code = strings.ToLower(code)
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+	if _, ok := helpHeader[code]; ok {
+		return code
+	}
+	return defaultLanguage
+}
+
+// синхронизировать меню команд Telegram с ролями: ученикам — общее меню,
+// учителям и администраторам — меню с их командами в личном чате
+func syncCommandMenu(m Messenger) {
+	if err := m.SetCommands(tgbotapi.NewBotCommandScopeDefault(), commands.BotCommands(RoleStudent)); err != nil {
+		log.Printf("Ошибка setMyCommands: %v", err)
+	}
+	for _, role := range []Role{RoleTeacher, RoleAdmin} {
+		for _, userID := range usersWithRole(role) {
+			syncUserCommandMenu(m, userID, role)
+		}
+	}
+}
+
+// обновить меню команд одного пользователя после смены роли
+func syncUserCommandMenu(m Messenger, userID int64, role Role) {
+	scope := tgbotapi.NewBotCommandScopeChat(userID)
+	if err := m.SetCommands(scope, commands.BotCommands(role)); err != nil {
+		log.Printf("Ошибка setMyCommands для %d: %v", userID, err)
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+
+	"LinguisticCombinatorics/internal/schema"
+)
+
+// создать недостающие служебные таблицы и колонки
+func ensureSchema(db *sql.DB) {
+	if err := schema.Ensure(db); err != nil {
+		log.Fatalf("Ошибка создания схемы: %v", err)
+	}
+}
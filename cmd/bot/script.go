@@ -0,0 +1,96 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Script — письменность, в которой ученик видит татарский текст
+type Script string
+
+const (
+	ScriptCyrillic Script = "cyrl"
+	ScriptLatin    Script = "latn"
+)
+
+// названия письменности для /script
+var scriptNames = map[string]Script{
+	"cyrl":      ScriptCyrillic,
+	"cyrillic":  ScriptCyrillic,
+	"кириллица": ScriptCyrillic,
+	"кирилл":    ScriptCyrillic,
+	"latn":      ScriptLatin,
+	"latin":     ScriptLatin,
+	"латиница":  ScriptLatin,
+	"латин":     ScriptLatin,
+}
+
+// татарский текст из базы (кириллица) в письменности ученика
+func (s Script) tatar(text string) string {
+	if s == ScriptLatin {
+		return toLatin(text)
+	}
+	return text
+}
+
+// введённый учеником текст в кириллицу для сравнения с базой
+func (s Script) cyrillic(text string) string {
+	if s == ScriptLatin {
+		return toCyrillic(text)
+	}
+	return text
+}
+
+// письменность ученика; по умолчанию кириллица
+func userScript(userID int64) Script {
+	db := openDB()
+	defer db.Close()
+
+	var script string
+	err := db.QueryRow(`SELECT script FROM User WHERE id = ?`, userID).Scan(&script)
+	if err == sql.ErrNoRows || script == "" {
+		return ScriptCyrillic
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return Script(script)
+}
+
+// сохранить письменность ученика
+func setUserScript(userID int64, script Script) {
+	db := openDB()
+	defer db.Close()
+
+	_, err := db.Exec(`UPDATE User SET script = ? WHERE id = ?`, string(script), userID)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Обработчик команды /script
+func handleScriptCommand(m Messenger, msg *tgbotapi.Message) {
+	arg := strings.ToLower(strings.TrimSpace(msg.CommandArguments()))
+	if arg == "" {
+		current := "кириллица"
+		if userScript(msg.From.ID) == ScriptLatin {
+			current = "латиница"
+		}
+		sendMessage(m, msg.Chat.ID, "Татарский текст: "+current+". Сменить: /script latin или /script cyrillic")
+		return
+	}
+	script, ok := scriptNames[arg]
+	if !ok {
+		sendMessage(m, msg.Chat.ID, "Неизвестная письменность. Доступны: latin, cyrillic")
+		return
+	}
+	setUserScript(msg.From.ID, script)
+	if script == ScriptLatin {
+		sendMessage(m, msg.Chat.ID, "Татарский текст будет показан латиницей (Zamanälif)")
+		return
+	}
+	sendMessage(m, msg.Chat.ID, "Татарский текст будет показан кириллицей")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/binary"
+	"log"
+	"time"
+)
+
+// начать новую сессию упражнения: кнопки прошлых попыток станут устаревшими
+func startSession(userID int64, exerciseID int64, direction string, practice string) uint32 {
+	nonce := newSessionNonce()
+
+	db := openDB()
+	defer db.Close()
+
+	_, err := db.Exec(`INSERT INTO ExerciseSession (user_id, exercise_id, nonce, started_at, direction, practice) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			exercise_id = excluded.exercise_id,
+			nonce = excluded.nonce,
+			started_at = excluded.started_at,
+			direction = excluded.direction,
+			practice = excluded.practice,
+			finished_at = NULL,
+			sub_question_id = NULL,
+			message_id = NULL,
+			compose = ''`,
+		userID, exerciseID, nonce, time.Now().Unix(), direction, practice)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return nonce
+}
+
+// у ученика есть незаконченная попытка упражнения
+func hasOpenSession(db *sql.DB, userID int64) bool {
+	var open bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM ExerciseSession WHERE user_id = ? AND finished_at IS NULL)`,
+		userID).Scan(&open)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return open
+}
+
+// кнопка ответа относится к текущей сессии пользователя и к подвопросу,
+// на который сейчас отвечают: кнопки прошлых вопросов той же попытки не принимаются
+func sessionAllowsOption(userID int64, nonce uint32, optionID int64) bool {
+	db := openDB()
+	defer db.Close()
+
+	var subQuestionID int64
+	err := db.QueryRow(`SELECT o.sub_question_id
+		FROM ExerciseSession s
+		JOIN SessionQuestion p ON p.user_id = s.user_id AND p.nonce = s.nonce
+		JOIN SubQuestion sq ON sq.question_id = p.question_id AND sq.direction = s.direction
+		JOIN Option o ON o.sub_question_id = sq.id
+		WHERE s.user_id = ? AND s.nonce = ? AND o.id = ?`, userID, nonce, optionID).Scan(&subQuestionID)
+	if err == sql.ErrNoRows {
+		return false
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	current, ok := currentSubQuestion(db, userID, nonce)
+	return ok && current == subQuestionID
+}
+
+// первый по плану попытки подвопрос без верного ответа; false — всё отвечено
+func currentSubQuestion(db *sql.DB, userID int64, nonce uint32) (int64, bool) {
+	var direction string
+	err := db.QueryRow(`SELECT direction FROM ExerciseSession WHERE user_id = ? AND nonce = ?`,
+		userID, nonce).Scan(&direction)
+	if err == sql.ErrNoRows {
+		return 0, false
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	answered := make(map[int64]bool)
+	rows, err := db.Query(`SELECT DISTINCT sub_question_id FROM AnswerEvent
+		WHERE user_id = ? AND nonce = ? AND is_right = 1`, userID, nonce)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			log.Fatal(err)
+		}
+		answered[id] = true
+	}
+	rows.Close()
+
+	var questions []int64
+	rows, err = db.Query(`SELECT question_id FROM SessionQuestion WHERE user_id = ? AND nonce = ? ORDER BY position`,
+		userID, nonce)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			log.Fatal(err)
+		}
+		questions = append(questions, id)
+	}
+	rows.Close()
+
+	for _, questionID := range questions {
+		subs := loadSubQuestions(db, questionID, direction)
+		for i := nextAnswerable(subs, 0); i < len(subs); i = nextAnswerable(subs, i+1) {
+			if !answered[subs[i].ID] {
+				return subs[i].ID, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// случайный ненулевой nonce сессии
+func newSessionNonce() uint32 {
+	var buf [4]byte
+	for {
+		if _, err := rand.Read(buf[:]); err != nil {
+			log.Fatal(err)
+		}
+		if nonce := binary.BigEndian.Uint32(buf[:]); nonce != 0 {
+			return nonce
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Подвопросы вопроса идут по seq_num. Строки с pointing = 1 — знаки
+// препинания и пробелы: ученик их не выбирает, они дописываются в поле ответа
+// сами. Любая серия таких строк — в начале предложения, между ответами или
+// в конце — склеивается в одну вставку.
+//
+// Как часть присоединяется к предыдущей, задаёт SubQuestion.joiner (Joiner).
+
+// Joiner — способ присоединить подвопрос к уже собранной части предложения
+type Joiner string
+
+const (
+	JoinLiteral Joiner = ""       // текст как есть: старые упражнения, где пробел — отдельная строка
+	JoinWord    Joiner = "word"   // отдельное слово через пробел
+	JoinSuffix  Joiner = "suffix" // аффикс, приклеивается к предыдущему слову
+	JoinPunct   Joiner = "punct"  // знак препинания, без пробела перед ним
+	JoinClause  Joiner = "clause" // начало новой части предложения: пробел и заглавная буква
+)
+
+// открывающие знаки: после них слово идёт без пробела
+const openingPunctuation = "«„“‘([{"
+
+// subQuestionRow — подвопрос в порядке seq_num
+type subQuestionRow struct {
+	ID       int64
+	SeqNum   int
+	Text     string
+	Pointing bool
+	Joiner   Joiner
+	Prompt   string // левая часть пары в упражнении на сопоставление
+}
+
+// все подвопросы вопроса по порядку
+func loadSubQuestions(db *sql.DB, questionID int64, direction string) []subQuestionRow {
+	rows, err := db.Query(`SELECT id, seq_num, text, pointing, joiner, prompt
+		FROM SubQuestion
+		WHERE question_id = ? AND direction = ?
+		ORDER BY seq_num`, questionID, direction)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+
+	var subs []subQuestionRow
+	for rows.Next() {
+		var sub subQuestionRow
+		if err := rows.Scan(&sub.ID, &sub.SeqNum, &sub.Text, &sub.Pointing, &sub.Joiner, &sub.Prompt); err != nil {
+			log.Fatal(err)
+		}
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// пропустить строки-пунктуацию начиная с from; возвращает индекс следующего
+// подвопроса для ответа (len(subs), если их больше нет)
+func nextAnswerable(subs []subQuestionRow, from int) int {
+	i := from
+	for i < len(subs) && subs[i].Pointing {
+		i++
+	}
+	return i
+}
+
+// номер подвопроса idx среди подвопросов для ответа и их число
+func answerablePosition(subs []subQuestionRow, idx int) (int, int) {
+	num, total := 0, 0
+	for i, sub := range subs {
+		if sub.Pointing {
+			continue
+		}
+		total++
+		if i <= idx {
+			num = total
+		}
+	}
+	return num, total
+}
+
+// собрать поле ответа из подвопросов по их Joiner. Пробелы ставятся только
+// перед следующей частью, поэтому в конце поля пробела не бывает
+func renderAnswerField(subs []subQuestionRow) string {
+	var field strings.Builder
+	pendingSpace := false
+	for _, sub := range subs {
+		text := sub.Text
+		switch sub.Joiner {
+		case JoinWord, JoinClause:
+			pendingSpace = field.Len() > 0 && !endsWithOpening(field.String())
+			text = strings.TrimSpace(text)
+			if sub.Joiner == JoinClause {
+				text = capitalize(text)
+			}
+		case JoinSuffix, JoinPunct:
+			pendingSpace = false
+			text = strings.TrimSpace(text)
+		default:
+			// пробелы в конце старой строки-вставки переносятся на следующую часть
+			body := strings.TrimRight(text, " ")
+			if body == "" {
+				pendingSpace = pendingSpace || text != ""
+				continue
+			}
+			text = body
+			if pendingSpace && field.Len() > 0 {
+				field.WriteString(" ")
+			}
+			field.WriteString(text)
+			pendingSpace = len(body) < len(sub.Text)
+			continue
+		}
+		if pendingSpace && field.Len() > 0 {
+			field.WriteString(" ")
+		}
+		field.WriteString(text)
+		pendingSpace = false
+	}
+	return field.String()
+}
+
+// поле заканчивается открывающей кавычкой или скобкой
+func endsWithOpening(text string) bool {
+	r, _ := utf8.DecodeLastRuneInString(text)
+	return strings.ContainsRune(openingPunctuation, r)
+}
+
+// первая буква заглавная
+func capitalize(text string) string {
+	r, size := utf8.DecodeRuneInString(text)
+	if r == utf8.RuneError {
+		return text
+	}
+	return string(unicode.ToUpper(r)) + text[size:]
+}
+
+// answerOption — вариант ответа на кнопке
+type answerOption struct {
+	ID   int64
+	Text string
+}
+
+// варианты ответа подвопроса в порядке загрузки
+func loadOptions(db *sql.DB, subQuestionID int64) []answerOption {
+	rows, err := db.Query(`SELECT id, text
+		FROM Option
+		WHERE sub_question_id = ?
+		ORDER BY id`, subQuestionID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+
+	var options []answerOption
+	for rows.Next() {
+		var option answerOption
+		if err := rows.Scan(&option.ID, &option.Text); err != nil {
+			log.Fatal(err)
+		}
+		options = append(options, option)
+	}
+	return options
+}
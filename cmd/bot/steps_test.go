@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestRenderAnswerField(t *testing.T) {
+	parts := func(specs ...string) []subQuestionRow {
+		var subs []subQuestionRow
+		for i := 0; i < len(specs); i += 2 {
+			subs = append(subs, subQuestionRow{Joiner: Joiner(specs[i]), Text: specs[i+1]})
+		}
+		return subs
+	}
+	tests := []struct {
+		name string
+		subs []subQuestionRow
+		want string
+	}{
+		{"слова", parts("word", "Мин", "word", "укыйм"), "Мин укыйм"},
+		{"аффиксы", parts("word", "Сез", "word", "бетер", "suffix", "ә", "suffix", "сез"), "Сез бетерәсез"},
+		{"знаки", parts("word", "Мин", "word", "укыйм", "punct", ",", "word", "син", "word", "язасың", "punct", "."), "Мин укыйм, син язасың."},
+		{"кавычки", parts("punct", "«", "word", "Мин", "word", "укыйм", "punct", "»"), "«Мин укыйм»"},
+		{"новая часть", parts("word", "Мин", "word", "укыйм", "punct", ";", "clause", "син", "word", "язасың"), "Мин укыйм; Син язасың"},
+		{"аффикс после знака", parts("word", "Мин", "punct", "-", "suffix", "дә"), "Мин-дә"},
+		{"пробел в конце не остаётся", parts("", "Сез", "", " "), "Сез"},
+		{"старый формат", parts("", "Сез", "", " ", "", "бетер", "", "ә", "", "сез"), "Сез бетерәсез"},
+		{"старые вставки подряд", parts("", "Мин", "", ",", "", " ", "", "син"), "Мин, син"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderAnswerField(tt.subs); got != tt.want {
+				t.Errorf("renderAnswerField() = %q, ожидалось %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+-- Фикстура для сквозных тестов бота: схема как в bot.db и два упражнения
+PRAGMA foreign_keys = ON;
+
+CREATE TABLE Exercise (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title TEXT NOT NULL
+);
+
+CREATE TABLE Question (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    exercise_id INTEGER NOT NULL,
+    text TEXT NOT NULL,
+    FOREIGN KEY (exercise_id) REFERENCES Exercise(id) ON DELETE CASCADE
+);
+
+CREATE TABLE SubQuestion (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    question_id INTEGER NOT NULL,
+    seq_num INTEGER NOT NULL,
+    pointing INTEGER NOT NULL DEFAULT 0,
+    text TEXT NOT NULL,
+    FOREIGN KEY (question_id) REFERENCES Question(id) ON DELETE CASCADE,
+    UNIQUE (question_id, seq_num)
+);
+
+CREATE TABLE Option (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    sub_question_id INTEGER NOT NULL,
+    text TEXT NOT NULL,
+    is_correct INTEGER DEFAULT 0,
+    FOREIGN KEY (sub_question_id) REFERENCES SubQuestion(id) ON DELETE CASCADE
+);
+
+INSERT INTO Exercise (id, title) VALUES (1, 'level1'), (2, 'level2');
+
+-- level1: два вопроса, слово собирается из основы и аффиксов
+INSERT INTO Question (id, exercise_id, text) VALUES (10, 1, 'вы заканчиваете'), (11, 1, 'мы закончим');
+
+INSERT INTO SubQuestion (id, question_id, seq_num, pointing, text) VALUES
+    (100, 10, 1, 0, 'Сез'),
+    (101, 10, 2, 1, ' '),
+    (102, 10, 3, 0, 'бетер'),
+    (103, 10, 4, 0, 'ә'),
+    (104, 10, 5, 0, 'сез'),
+    (110, 11, 1, 0, 'Без'),
+    (111, 11, 2, 1, ' '),
+    (112, 11, 3, 0, 'бетер'),
+    (113, 11, 4, 0, 'ер'),
+    (114, 11, 5, 0, 'без');
+
+INSERT INTO Option (sub_question_id, text) VALUES
+    (100, 'Мин'), (100, 'Сез'), (100, 'Без'),
+    (102, 'башла'), (102, 'бетер'), (102, 'уйла'),
+    (103, 'ә'), (103, 'а'), (103, 'и'),
+    (104, 'м'), (104, 'сез'), (104, 'без'),
+    (110, 'Мин'), (110, 'Сез'), (110, 'Без'),
+    (112, 'башла'), (112, 'бетер'), (112, 'уйла'),
+    (113, 'ер'), (113, 'ыр'), (113, 'ар'),
+    (114, 'м'), (114, 'сез'), (114, 'без');
+
+-- level2: один вопрос из двух слов
+INSERT INTO Question (id, exercise_id, text) VALUES (20, 2, 'я читаю');
+
+INSERT INTO SubQuestion (id, question_id, seq_num, pointing, text) VALUES
+    (200, 20, 1, 0, 'Мин'),
+    (201, 20, 2, 1, ' '),
+    (202, 20, 3, 0, 'укы'),
+    (203, 20, 4, 0, 'ым');
+
+INSERT INTO Option (sub_question_id, text) VALUES
+    (200, 'Мин'), (200, 'Син'),
+    (202, 'укы'), (202, 'яз'),
+    (203, 'ым'), (203, 'ыйм');
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Транслитерация татарского текста между кириллицей и латиницей
+// (Заманәлиф). Правила упрощены до тех, что нужны для учебных предложений:
+// к/г перед и после гласных заднего ряда — q/ğ, у/ү после гласной — w,
+// е/ю/я в начале слова и после гласной — ye/yu/ya (yü/yä в словах
+// переднего ряда), ь опускается.
+
+var cyrillicToLatin = map[rune]string{
+	'а': "a", 'ә': "ä", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo",
+	'ж': "j", 'җ': "c", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'ң': "ñ", 'о': "o", 'ө': "ö", 'п': "p", 'р': "r", 'с': "s", 'т': "t",
+	'у': "u", 'ү': "ü", 'ф': "f", 'х': "x", 'һ': "h", 'ц': "ts", 'ч': "ç", 'ш': "ş",
+	'щ': "şç", 'ъ': "'", 'ы': "ı", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+}
+
+var latinToCyrillic = map[rune]rune{
+	'a': 'а', 'ä': 'ә', 'b': 'б', 'c': 'җ', 'ç': 'ч', 'd': 'д', 'e': 'е', 'f': 'ф',
+	'g': 'г', 'ğ': 'г', 'h': 'һ', 'ı': 'ы', 'i': 'и', 'j': 'ж', 'k': 'к', 'l': 'л',
+	'm': 'м', 'n': 'н', 'ñ': 'ң', 'o': 'о', 'ö': 'ө', 'p': 'п', 'q': 'к', 'r': 'р',
+	's': 'с', 'ş': 'ш', 't': 'т', 'u': 'у', 'ü': 'ү', 'v': 'в', 'x': 'х', 'y': 'й',
+	'z': 'з',
+}
+
+const (
+	cyrillicVowels = "аәеёиоөуүыэюя"
+	backVowels     = "аоуыёюя"
+)
+
+func isVowel(r rune, vowels string) bool {
+	return strings.ContainsRune(vowels, unicode.ToLower(r))
+}
+
+// слово переднего ряда: есть ә, ө, ү или только гласные переднего ряда
+func frontWord(word []rune) bool {
+	back := false
+	for _, r := range word {
+		switch r = unicode.ToLower(r); {
+		case strings.ContainsRune("әөү", r):
+			return true
+		case strings.ContainsRune("аоуы", r):
+			back = true
+		}
+	}
+	return !back
+}
+
+// ближайшая гласная рядом с позицией i (сначала следующая, потом предыдущая)
+func neighbourVowel(word []rune, i int) (rune, bool) {
+	if i+1 < len(word) && isVowel(word[i+1], cyrillicVowels) {
+		return unicode.ToLower(word[i+1]), true
+	}
+	if i > 0 && isVowel(word[i-1], cyrillicVowels) {
+		return unicode.ToLower(word[i-1]), true
+	}
+	return 0, false
+}
+
+// сохранить регистр исходной буквы
+func withCase(src rune, latin string) string {
+	if !unicode.IsUpper(src) || latin == "" {
+		return latin
+	}
+	switch latin {
+	case "i":
+		return "İ"
+	case "ı":
+		return "I"
+	}
+	runes := []rune(latin)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+// разбить текст на слова и промежутки между ними
+func splitWords(text string, convert func([]rune) string) string {
+	var out strings.Builder
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			out.WriteString(convert(word))
+			word = word[:0]
+		}
+	}
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		out.WriteRune(r)
+	}
+	flush()
+	return out.String()
+}
+
+// кириллица → латиница
+func toLatin(text string) string {
+	return splitWords(text, func(word []rune) string {
+		front := frontWord(word)
+		var out strings.Builder
+		for i, src := range word {
+			r := unicode.ToLower(src)
+			latin, ok := cyrillicToLatin[r]
+			if !ok {
+				out.WriteRune(src)
+				continue
+			}
+			afterVowel := i > 0 && isVowel(word[i-1], cyrillicVowels)
+			iotated := i == 0 || afterVowel || (i > 0 && strings.ContainsRune("ъь", unicode.ToLower(word[i-1])))
+			switch r {
+			case 'к', 'г':
+				vowel, near := neighbourVowel(word, i)
+				if (near && strings.ContainsRune(backVowels, vowel)) || (!near && !front) {
+					latin = map[rune]string{'к': "q", 'г': "ğ"}[r]
+				}
+			case 'у', 'ү':
+				if afterVowel {
+					latin = "w"
+				}
+			case 'е':
+				if iotated {
+					latin = "ye"
+				}
+			case 'я':
+				if front {
+					latin = "yä"
+				}
+			case 'ю':
+				if front {
+					latin = "yü"
+				}
+			}
+			out.WriteString(withCase(src, latin))
+		}
+		return out.String()
+	})
+}
+
+// латиница → кириллица (для введённых ответов)
+func toCyrillic(text string) string {
+	return splitWords(text, func(word []rune) string {
+		lower := make([]rune, len(word))
+		front := false
+		for i, src := range word {
+			lower[i] = unicode.ToLower(src)
+			if src == 'I' {
+				lower[i] = 'ı' // заглавная I — это Ы, İ — это И
+			}
+			if strings.ContainsRune("äöüei", lower[i]) {
+				front = true
+			}
+		}
+		var out strings.Builder
+		for i := 0; i < len(word); i++ {
+			src, r := word[i], lower[i]
+			var cyr rune
+			next := rune(0)
+			if i+1 < len(lower) {
+				next = lower[i+1]
+			}
+			switch {
+			case r == 'y' && (next == 'a' || next == 'ä'):
+				cyr, i = 'я', i+1
+			case r == 'y' && (next == 'u' || next == 'ü'):
+				cyr, i = 'ю', i+1
+			case r == 'y' && next == 'o':
+				cyr, i = 'ё', i+1
+			case r == 'y' && next == 'e':
+				cyr, i = 'е', i+1
+			case r == 'e' && i == 0:
+				cyr = 'э'
+			case r == 'w':
+				cyr = 'у'
+				if front {
+					cyr = 'ү'
+				}
+			default:
+				var ok bool
+				if cyr, ok = latinToCyrillic[r]; !ok {
+					out.WriteRune(src)
+					continue
+				}
+			}
+			if unicode.IsUpper(src) {
+				cyr = unicode.ToUpper(cyr)
+			}
+			out.WriteRune(cyr)
+		}
+		return out.String()
+	})
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestTransliteration(t *testing.T) {
+	tests := []struct{ cyrillic, latin string }{
+		{"Сез бетерәсез", "Sez beteräsez"},
+		{"Мин укыйм, син язасың.", "Min uqıym, sin yazasıñ."},
+		{"җир", "cir"},
+		{"яңа китап", "yaña kitap"},
+		{"Ел", "Yel"},
+		{"эш", "eş"},
+		{"егет", "yeget"},
+		{"тау", "taw"},
+		{"Илһам", "İlham"},
+		{"Ыргак", "Irğaq"},
+	}
+	for _, tt := range tests {
+		if got := toLatin(tt.cyrillic); got != tt.latin {
+			t.Errorf("toLatin(%q) = %q, ожидалось %q", tt.cyrillic, got, tt.latin)
+		}
+		if got := toCyrillic(tt.latin); got != tt.cyrillic {
+			t.Errorf("toCyrillic(%q) = %q, ожидалось %q", tt.latin, got, tt.cyrillic)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"database/sql"
+	"html"
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Режим ввода: вместо кнопок ученик пишет ответ сообщением. В режиме words
+// каждое слово вводится отдельно (слово — подвопрос вместе с приклеенными
+// аффиксами), в режиме sentence — всё предложение сразу.
+
+// Режимы ответа упражнения (Exercise.answer_mode)
+const (
+	AnswerButtons  = ""
+	AnswerWords    = "words"
+	AnswerSentence = "sentence"
+)
+
+// режим ответа упражнения
+func exerciseAnswerMode(exerciseID int64) string {
+	db := openDB()
+	defer db.Close()
+
+	var mode string
+	if err := db.QueryRow(`SELECT answer_mode FROM Exercise WHERE id = ?`, exerciseID).Scan(&mode); err != nil {
+		log.Fatal(err)
+	}
+	return mode
+}
+
+// typedSession — активная сессия в режиме ввода
+type typedSession struct {
+	ExerciseID    int64
+	Nonce         uint32
+	Mode          string
+	SubQuestionID int64  // первый подвопрос слова, которое ждём
+	MessageID     int    // сообщение с вопросом
+	Compose       string // набранная часть ответа (экранные буквы и незаконченный ввод)
+	Direction     string // направление перевода попытки
+	Script        Script // письменность, в которой ученик вводит ответ
+}
+
+// активная сессия ученика в режиме ввода; nil — ответ текстом не ждём
+func loadTypedSession(userID int64) *typedSession {
+	db := openDB()
+	defer db.Close()
+
+	var s typedSession
+	err := db.QueryRow(`SELECT s.exercise_id, s.nonce, e.answer_mode, s.sub_question_id, s.message_id, s.compose, s.direction
+		FROM ExerciseSession s
+		JOIN Exercise e ON e.id = s.exercise_id
+		WHERE s.user_id = ?
+		  AND s.finished_at IS NULL
+		  AND e.answer_mode != ''
+		  AND s.practice = ''
+		  AND s.sub_question_id IS NOT NULL`, userID).
+		Scan(&s.ExerciseID, &s.Nonce, &s.Mode, &s.SubQuestionID, &s.MessageID, &s.Compose, &s.Direction)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	s.Script = answerScript(userScript(userID), s.Direction)
+	return &s
+}
+
+// запомнить, какой ответ ждём и в каком сообщении вопрос; набранное сбрасывается
+func setTypedPosition(userID int64, nonce uint32, subQuestionID int64, messageID int) {
+	db := openDB()
+	defer db.Close()
+
+	_, err := db.Exec(`UPDATE ExerciseSession SET sub_question_id = ?, message_id = ?, compose = ''
+		WHERE user_id = ? AND nonce = ?`, subQuestionID, messageID, userID, nonce)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// сохранить набранную часть ответа
+func setCompose(userID int64, nonce uint32, compose string) {
+	db := openDB()
+	defer db.Close()
+
+	_, err := db.Exec(`UPDATE ExerciseSession SET compose = ? WHERE user_id = ? AND nonce = ?`, compose, userID, nonce)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// записать введённый ответ; hint — ученик получил подсказку
+func recordTypedAnswer(userID int64, nonce uint32, subQuestionID int64, text string, isRight bool, hint bool) {
+	db := openDB()
+	defer db.Close()
+
+	_, err := db.Exec(`INSERT INTO AnswerEvent (user_id, exercise_id, nonce, sub_question_id, option_id, answer_text, is_right, hint, created_at)
+		SELECT s.user_id, s.exercise_id, s.nonce, ?, 0, ?, ?, ?, ?
+		FROM ExerciseSession s
+		WHERE s.user_id = ? AND s.nonce = ?`,
+		subQuestionID, text, isRight, hint, time.Now().Unix(), userID, nonce)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// слова для ввода: диапазоны [начало, конец) подвопросов. В режиме sentence
+// всё предложение — одно «слово»
+func typedChunks(subs []subQuestionRow, mode string) [][2]int {
+	var chunks [][2]int
+	for i := nextAnswerable(subs, 0); i < len(subs); {
+		end := i + 1
+		if mode == AnswerSentence {
+			end = len(subs)
+		} else {
+			// аффиксы приклеены к слову и вводятся вместе с ним
+			for end < len(subs) && !subs[end].Pointing &&
+				(subs[end].Joiner == JoinSuffix || subs[end].Joiner == JoinLiteral) {
+				end++
+			}
+		}
+		chunks = append(chunks, [2]int{i, end})
+		i = nextAnswerable(subs, end)
+	}
+	return chunks
+}
+
+// typedQuestion — вопрос в режиме ввода: что уже собрано и какое слово ждём
+type typedQuestion struct {
+	Item   Item
+	Mode   string
+	Script Script // письменность ответа
+	Subs   []subQuestionRow
+	Start  int // первый подвопрос ожидаемого слова
+	End    int // конец слова (не включая)
+}
+
+// загрузить вопрос, на который отвечает ученик
+func loadTypedQuestion(userID int64, session *typedSession) *typedQuestion {
+	db := openDB()
+	defer db.Close()
+
+	q := &typedQuestion{Mode: session.Mode, Script: session.Script}
+	q.Item.Direction, q.Item.Script = session.Direction, userScript(userID)
+	err := db.QueryRow(`SELECT q.id, q.text FROM SubQuestion sq JOIN Question q ON q.id = sq.question_id WHERE sq.id = ?`,
+		session.SubQuestionID).Scan(&q.Item.QuestionID, &q.Item.Question)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if session.Direction == DirectionReverse {
+		q.Item.Question = tatarSentence(db, q.Item.QuestionID)
+	}
+	q.Item.Number, q.Item.Total = sessionQuestionPosition(db, userID, session.Nonce, q.Item.QuestionID)
+	q.Subs = loadSubQuestions(db, q.Item.QuestionID, session.Direction)
+	q.Start, q.End = 0, len(q.Subs)
+	for _, chunk := range typedChunks(q.Subs, session.Mode) {
+		if q.Subs[chunk[0]].ID == session.SubQuestionID {
+			q.Start, q.End = chunk[0], chunk[1]
+		}
+	}
+	q.setProgress()
+	return q
+}
+
+// ожидаемый ответ на текущее слово
+func (q *typedQuestion) expected() string {
+	return renderAnswerField(q.Subs[q.Start:q.End])
+}
+
+// номер слова для строки прогресса
+func (q *typedQuestion) setProgress() {
+	q.Item.Word, q.Item.Words = 0, 0
+	if q.Mode == AnswerSentence {
+		return
+	}
+	chunks := typedChunks(q.Subs, q.Mode)
+	q.Item.Words = len(chunks)
+	for i, chunk := range chunks {
+		if chunk[0] == q.Start {
+			q.Item.Word = i + 1
+		}
+	}
+}
+
+// текст вопроса в режиме ввода; compose — набранная часть ответа
+func typedQuestionText(item Item, mode string, answerField string, compose string, done bool) string {
+	text := questionText(item, answerField, done)
+	if done {
+		return text
+	}
+	if compose != "" {
+		text += "\nНабрано: <code>" + html.EscapeString(compose) + "</code>"
+	}
+	if mode == AnswerSentence {
+		return text + "\n\n✍️ Напишите перевод целиком"
+	}
+	return text + "\n\n✍️ Напишите следующее слово"
+}
+
+// показать вопрос в режиме ввода с набранной частью и экранными буквами
+func (q *typedQuestion) show(m Messenger, chatID int64, messageID int, nonce uint32, compose string) {
+	text := typedQuestionText(q.Item, q.Mode, renderAnswerField(q.Subs[:q.Start]), compose, false)
+	m.EditHTML(chatID, messageID, text, lettersKeyboard(q.Mode, nonce, compose != "", q.Script))
+}
+
+// отправить вопрос в режиме ввода
+func sendTypedQuestion(m Messenger, chatID int64, userID int64, nonce uint32, mode string, item Item) {
+	db := openDB()
+	subs := loadSubQuestions(db, item.QuestionID, item.Direction)
+	db.Close()
+
+	script := answerScript(item.Script, item.Direction)
+	q := &typedQuestion{Item: item, Mode: mode, Script: script, Subs: subs, Start: nextAnswerable(subs, 0)}
+	q.setProgress()
+	messageID, err := m.SendHTML(chatID, typedQuestionText(q.Item, mode, item.Lead, "", false), lettersKeyboard(mode, nonce, false, script))
+	if err != nil {
+		log.Printf("Ошибка отправки вопроса: %v", err)
+	}
+	setTypedPosition(userID, nonce, item.AnswerID, messageID)
+}
+
+// обработать введённый ответ; false — ученик сейчас не в режиме ввода
+func handleTypedAnswer(m Messenger, msg *tgbotapi.Message) bool {
+	session := loadTypedSession(msg.From.ID)
+	if session == nil {
+		return false
+	}
+	// текст дописывается к тому, что набрано экранными буквами; ответ,
+	// написанный сообщением целиком, проверяется сразу
+	checkTypedAnswer(m, msg.Chat, msg.From.ID, session, session.Compose+msg.Text, session.Compose != "")
+	return true
+}
+
+// проверить ответ на текущее слово. partial — ответ собирается экранными
+// буквами: начало правильного ответа не считается ошибкой, а остаётся
+// в наборе, чтобы его дописать
+func checkTypedAnswer(m Messenger, chat *tgbotapi.Chat, userID int64, session *typedSession, text string, partial bool) {
+	q := loadTypedQuestion(userID, session)
+	expected := q.expected()
+
+	match := matchTypedAnswer(session.Script.cyrillic(text), expected)
+	if match.Verdict == typedLetter {
+		match.Feedback = letterHint + session.Script.tatar(expected)
+	}
+	if !match.right() && partial && isAnswerPrefix(session.Script.cyrillic(text), expected) {
+		setCompose(userID, session.Nonce, text)
+		q.show(m, chat.ID, session.MessageID, session.Nonce, text)
+		return
+	}
+
+	recordTypedAnswer(userID, session.Nonce, session.SubQuestionID, text, match.right(), match.hint())
+	if match.Feedback != "" {
+		sendMessage(m, chat.ID, match.Feedback)
+	}
+	if !match.right() {
+		if session.Compose != "" {
+			setCompose(userID, session.Nonce, "")
+			q.show(m, chat.ID, session.MessageID, session.Nonce, "")
+		}
+		return
+	}
+
+	next := nextAnswerable(q.Subs, q.End)
+	if next < len(q.Subs) {
+		q.Start = next
+		q.setProgress()
+		setTypedPosition(userID, session.Nonce, q.Subs[next].ID, session.MessageID)
+		q.show(m, chat.ID, session.MessageID, session.Nonce, "")
+		return
+	}
+
+	// вопрос собран
+	m.EditHTML(chat.ID, session.MessageID, typedQuestionText(q.Item, q.Mode, renderAnswerField(q.Subs), "", true), nil)
+	db := openDB()
+	nextQuestionID, ok := nextPlannedQuestion(db, userID, session.Nonce, q.Item.QuestionID)
+	db.Close()
+	if !ok {
+		exerciseID := finishSession(userID, session.Nonce)
+		// вопрос уже выше сообщений ученика, итог отправляем новым сообщением
+		afterExerciseFinished(m, &tgbotapi.Message{Chat: chat}, userID, exerciseID)
+		return
+	}
+	nextItem := LoadItem(nextQuestionID, session.Direction)
+	nextItem.Number, nextItem.Total = q.Item.Number+1, q.Item.Total
+	nextItem.Script = q.Item.Script
+	markQuestionSeen(userID, nextQuestionID)
+	sendTypedQuestion(m, chat.ID, userID, session.Nonce, session.Mode, nextItem)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Упражнение с unlock_accuracy = X открывается, когда все упражнения
+// предыдущего уровня пройдены с точностью не ниже X%. Учителя и администраторы
+// видят все упражнения; администратор может открыть упражнение ученику вручную,
+// учитель — задать его классу.
+
+// причина, по которой упражнение закрыто для пользователя; "" — доступно
+func exerciseLockReason(userID int64, exerciseID int64) string {
+	if userRole(userID) >= RoleTeacher {
+		return ""
+	}
+
+	db := openDB()
+	defer db.Close()
+
+	var level, accuracy int
+	err := db.QueryRow(`SELECT level, unlock_accuracy FROM Exercise WHERE id = ?`, exerciseID).Scan(&level, &accuracy)
+	if err == sql.ErrNoRows {
+		return "Упражнение не найдено"
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if accuracy <= 0 || level <= 0 {
+		return ""
+	}
+
+	var manual bool
+	err = db.QueryRow(`SELECT EXISTS (SELECT 1 FROM ExerciseUnlock WHERE user_id = ? AND exercise_id = ?)`,
+		userID, exerciseID).Scan(&manual)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if manual || exerciseAssigned(db, userID, exerciseID) {
+		return ""
+	}
+
+	var prevLevel sql.NullInt64
+	err = db.QueryRow(`SELECT MAX(level) FROM Exercise WHERE level > 0 AND level < ?`, level).Scan(&prevLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !prevLevel.Valid {
+		return "" // первый уровень всегда открыт
+	}
+
+	var missing int
+	err = db.QueryRow(`SELECT COUNT(*)
+		FROM Exercise e
+		WHERE e.level = ?
+		  AND NOT EXISTS (
+			SELECT 1 FROM ExerciseResult r
+			WHERE r.user_id = ? AND r.exercise_id = e.id
+			  AND r.answers > 0 AND r.right_answers * 100 >= ? * r.answers
+		  )`, prevLevel.Int64, userID, accuracy).Scan(&missing)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if missing == 0 {
+		return ""
+	}
+	return fmt.Sprintf("🔒 Откроется после прохождения уровня %d с точностью от %d%%", prevLevel.Int64, accuracy)
+}
+
+// закрытые для ученика упражнения одним запросом — по тем же правилам, что
+// exerciseLockReason (задание класса — тем же assignedExerciseSQL, что
+// и exerciseAssigned); для учителей и администраторов вызывающий не проверяет
+func lockedExercises(db *sql.DB, userID int64) map[int64]bool {
+	rows, err := db.Query(`SELECT e.id
+		FROM Exercise e
+		WHERE e.unlock_accuracy > 0 AND e.level > 0
+		  AND NOT EXISTS (SELECT 1 FROM ExerciseUnlock u WHERE u.user_id = ? AND u.exercise_id = e.id)
+		  AND NOT `+assignedExerciseSQL("e.id")+`
+		  AND EXISTS (
+			SELECT 1 FROM Exercise p
+			WHERE p.level = (SELECT MAX(level) FROM Exercise WHERE level > 0 AND level < e.level)
+			  AND NOT EXISTS (
+				SELECT 1 FROM ExerciseResult r
+				WHERE r.user_id = ? AND r.exercise_id = p.id
+				  AND r.answers > 0 AND r.right_answers * 100 >= e.unlock_accuracy * r.answers
+			  )
+		  )`, userID, userID, userID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+
+	locked := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			log.Fatal(err)
+		}
+		locked[id] = true
+	}
+	return locked
+}
+
+// открыть упражнение пользователю вручную
+func unlockExercise(userID int64, exerciseID int64, unlockedBy int64) {
+	db := openDB()
+	defer db.Close()
+
+	_, err := db.Exec(`INSERT OR IGNORE INTO ExerciseUnlock (user_id, exercise_id, unlocked_by, created_at)
+		VALUES (?, ?, ?, ?)`, userID, exerciseID, unlockedBy, time.Now().Unix())
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Обработчик команды /unlock <id пользователя> <id упражнения>
+func handleUnlockCommand(m Messenger, msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) != 2 {
+		sendMessage(m, msg.Chat.ID, "Формат: /unlock <id пользователя> <id упражнения>")
+		return
+	}
+	userID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		sendMessage(m, msg.Chat.ID, "Некорректный id пользователя")
+		return
+	}
+	exerciseID, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		sendMessage(m, msg.Chat.ID, "Некорректный id упражнения")
+		return
+	}
+
+	db := openDB()
+	var title string
+	err = db.QueryRow(`SELECT title FROM Exercise WHERE id = ?`, exerciseID).Scan(&title)
+	db.Close()
+	if err == sql.ErrNoRows {
+		sendMessage(m, msg.Chat.ID, "Упражнение не найдено")
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	unlockExercise(userID, exerciseID, msg.From.ID)
+	sendMessage(m, msg.Chat.ID, fmt.Sprintf("Упражнение «%s» открыто пользователю %d", title, userID))
+}
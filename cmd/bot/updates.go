@@ -0,0 +1,90 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Сколько последних update_id хранить в ProcessedUpdate
+const processedUpdatesKeep = 1000
+
+const updateOffsetKey = "update_offset"
+
+// получить offset, с которого нужно продолжить getUpdates
+func loadUpdateOffset() int {
+	db := openDB()
+	defer db.Close()
+
+	var value string
+	err := db.QueryRow(`SELECT value FROM BotState WHERE key = ?`, updateOffsetKey).Scan(&value)
+	if err == sql.ErrNoRows {
+		return 0
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	offset, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Некорректный offset в BotState: %q", value)
+		return 0
+	}
+	return offset
+}
+
+// обработано ли уже обновление с таким update_id
+func isUpdateProcessed(updateID int) bool {
+	db := openDB()
+	defer db.Close()
+
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM ProcessedUpdate WHERE update_id = ?)`, updateID).Scan(&exists)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return exists
+}
+
+// запомнить обработанное обновление, сдвинуть offset и подчистить старые записи
+func markUpdateProcessed(updateID int) {
+	db := openDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO ProcessedUpdate (update_id, processed_at) VALUES (?, ?)`,
+		updateID, time.Now().Unix()); err != nil {
+		log.Fatal(err)
+	}
+	// offset только растёт: повторно доставленное старое обновление его не откатит
+	if _, err := tx.Exec(`INSERT INTO BotState (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value
+		WHERE CAST(excluded.value AS INTEGER) > CAST(BotState.value AS INTEGER)`,
+		updateOffsetKey, strconv.Itoa(updateID+1)); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := tx.Exec(`DELETE FROM ProcessedUpdate WHERE update_id <= ?`,
+		updateID-processedUpdatesKeep); err != nil {
+		log.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// обработать обновление ровно один раз, даже если Telegram доставил его повторно
+func processUpdate(m Messenger, update tgbotapi.Update) {
+	if isUpdateProcessed(update.UpdateID) {
+		log.Printf("Обновление %d уже обработано, пропускаем", update.UpdateID)
+		return
+	}
+	handleUpdate(m, update)
+	markUpdateProcessed(update.UpdateID)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Role — роль пользователя из диаграммы вариантов использования.
+// Роли упорядочены: администратор умеет всё, что учитель, учитель — всё, что ученик.
+type Role int
+
+const (
+	RoleStudent Role = iota
+	RoleTeacher
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleStudent: "student",
+	RoleTeacher: "teacher",
+	RoleAdmin:   "admin",
+}
+
+func (r Role) String() string {
+	return roleNames[r]
+}
+
+// разобрать роль из строки; ok == false для неизвестной роли
+func parseRole(s string) (Role, bool) {
+	for role, name := range roleNames {
+		if name == strings.ToLower(strings.TrimSpace(s)) {
+			return role, true
+		}
+	}
+	return RoleStudent, false
+}
+
+// запомнить пользователя, его имя и язык интерфейса
+func rememberUser(from *tgbotapi.User) {
+	if from == nil {
+		return
+	}
+	db := openDB()
+	defer db.Close()
+
+	_, err := db.Exec(`INSERT INTO User (id, role, language, name, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			language = CASE WHEN excluded.language != '' THEN excluded.language ELSE language END,
+			name = excluded.name`,
+		from.ID, RoleStudent.String(), from.LanguageCode, displayName(from), time.Now().Unix())
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// имя пользователя для таблиц результатов: имя и фамилия или @username
+func displayName(from *tgbotapi.User) string {
+	name := strings.TrimSpace(from.FirstName + " " + from.LastName)
+	if name == "" && from.UserName != "" {
+		name = "@" + from.UserName
+	}
+	return name
+}
+
+// сохранённое имя пользователя; если его нет — id
+func userName(db *sql.DB, userID int64) string {
+	var name string
+	err := db.QueryRow(`SELECT name FROM User WHERE id = ?`, userID).Scan(&name)
+	if err != nil && err != sql.ErrNoRows {
+		log.Fatal(err)
+	}
+	if name == "" {
+		name = fmt.Sprintf("id %d", userID)
+	}
+	return name
+}
+
+// роль пользователя; незнакомые пользователи — ученики
+func userRole(userID int64) Role {
+	db := openDB()
+	defer db.Close()
+
+	var name string
+	err := db.QueryRow(`SELECT role FROM User WHERE id = ?`, userID).Scan(&name)
+	if err == sql.ErrNoRows {
+		return RoleStudent
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	role, _ := parseRole(name)
+	return role
+}
+
+// назначить пользователю роль
+func setUserRole(userID int64, role Role) {
+	db := openDB()
+	defer db.Close()
+
+	_, err := db.Exec(`INSERT INTO User (id, role, language, created_at) VALUES (?, ?, '', ?)
+		ON CONFLICT(id) DO UPDATE SET role = excluded.role`,
+		userID, role.String(), time.Now().Unix())
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// пользователи с заданной ролью
+func usersWithRole(role Role) []int64 {
+	db := openDB()
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id FROM User WHERE role = ? ORDER BY id`, role.String())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			log.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// назначить администраторами пользователей из BOT_ADMIN_IDS (через запятую)
+func bootstrapAdmins() {
+	for _, field := range strings.Split(os.Getenv("BOT_ADMIN_IDS"), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			log.Printf("Некорректный id администратора %q: %v", field, err)
+			continue
+		}
+		setUserRole(id, RoleAdmin)
+	}
+}
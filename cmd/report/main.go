@@ -0,0 +1,76 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	_ "modernc.org/sqlite"
+
+	"LinguisticCombinatorics/internal/report"
+	"LinguisticCombinatorics/internal/schema"
+)
+
+// Отчёт учителя в Excel по базе бота:
+//
+//	report -class <id класса> [-db bot.db] [-o отчёт.xlsx]
+//	report -exercise <id упражнения> [-db bot.db] [-o отчёт.xlsx]
+//
+// и анализ вариантов ответов упражнения для автора (печатается в консоль):
+//
+//	report -distractors <id упражнения> [-db bot.db]
+func main() {
+	dbPath := flag.String("db", "bot.db", "путь к базе бота")
+	classroomID := flag.Int64("class", 0, "id класса")
+	exerciseID := flag.Int64("exercise", 0, "id упражнения")
+	distractorsID := flag.Int64("distractors", 0, "id упражнения для анализа вариантов ответов")
+	out := flag.String("o", "", "файл отчёта; по умолчанию «Отчёт — <название>.xlsx»")
+	flag.Parse()
+
+	if (*classroomID == 0) == (*exerciseID == 0) && *distractorsID == 0 {
+		fmt.Println("Укажите -class <id класса>, -exercise <id упражнения> или -distractors <id упражнения>")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	db, err := sql.Open("sqlite", *dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	if err := schema.Ensure(db); err != nil {
+		log.Fatal(err)
+	}
+
+	if *distractorsID != 0 {
+		title, stats, err := report.Distractors(db, *distractorsID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(report.DistractorText(title, stats))
+		return
+	}
+
+	var r *report.Report
+	if *classroomID != 0 {
+		r, err = report.ForClassroom(db, *classroomID)
+	} else {
+		r, err = report.ForExercise(db, *exerciseID, 0)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	book, err := r.Workbook()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *out == "" {
+		*out = r.FileName()
+	}
+	if err := book.SaveAs(*out); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Отчёт сохранён: %s (учеников × упражнений: %d, частых ошибок: %d)\n", *out, len(r.Rows), len(r.Mistakes))
+}
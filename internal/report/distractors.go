@@ -0,0 +1,186 @@
+package report
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Анализ дистракторов: как часто ученики выбирают каждый неверный вариант
+// подвопроса. Считаются все ответы кнопками (AnswerEvent.option_id != 0),
+// включая викторины; верный вариант — тот, чей текст совпадает с текстом
+// подвопроса. Выводы делаются только по подвопросам, на которые ответили
+// хотя бы MinSample раз.
+
+// Пороги флагов
+const (
+	MinSample   = 5  // первых ответов на подвопрос, чтобы делать выводы
+	HardPercent = 80 // доля неверных первых ответов, при которой подвопрос слишком трудный
+)
+
+// OptionStat — вариант подвопроса и его выборы
+type OptionStat struct {
+	OptionID int64
+	Text     string
+	Right    bool
+	Picks    int
+}
+
+// SubQuestionStat — ответы на подвопрос по вариантам
+type SubQuestionStat struct {
+	SubQuestionID int64
+	Question      string
+	Answer        string
+	Encounters    int // первые ответы: по одному на ученика и попытку
+	FirstWrong    int // из них неверные
+	Answers       int // все ответы кнопками
+	Options       []OptionStat
+}
+
+// данных достаточно для выводов
+func (s SubQuestionStat) enough() bool {
+	return s.Encounters >= MinSample
+}
+
+// TooHard — почти все ошибаются с первого раза
+func (s SubQuestionStat) TooHard() bool {
+	return s.enough() && s.FirstWrong*100 >= HardPercent*s.Encounters
+}
+
+// Unpicked — неверные варианты, которые никто не выбирает
+func (s SubQuestionStat) Unpicked() []OptionStat {
+	if !s.enough() {
+		return nil
+	}
+	var unpicked []OptionStat
+	for _, o := range s.Options {
+		if !o.Right && o.Picks == 0 {
+			unpicked = append(unpicked, o)
+		}
+	}
+	return unpicked
+}
+
+// Distractors — статистика вариантов по подвопросам упражнения; возвращает и название упражнения
+func Distractors(db *sql.DB, exerciseID int64) (string, []SubQuestionStat, error) {
+	var title string
+	err := db.QueryRow(`SELECT title FROM Exercise WHERE id = ?`, exerciseID).Scan(&title)
+	if err == sql.ErrNoRows {
+		return "", nil, fmt.Errorf("упражнение %d не найдено", exerciseID)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	rows, err := db.Query(`SELECT sq.id, q.text, sq.text
+		FROM SubQuestion sq
+		JOIN Question q ON q.id = sq.question_id
+		WHERE q.exercise_id = ? AND sq.pointing = 0
+		  AND EXISTS (SELECT 1 FROM Option o WHERE o.sub_question_id = sq.id)
+		ORDER BY q.id, sq.direction DESC, sq.seq_num`, exerciseID)
+	if err != nil {
+		return "", nil, err
+	}
+	var stats []SubQuestionStat
+	for rows.Next() {
+		var s SubQuestionStat
+		if err := rows.Scan(&s.SubQuestionID, &s.Question, &s.Answer); err != nil {
+			rows.Close()
+			return "", nil, err
+		}
+		stats = append(stats, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", nil, err
+	}
+
+	for i := range stats {
+		if err := stats[i].load(db); err != nil {
+			return "", nil, err
+		}
+	}
+	return title, stats, nil
+}
+
+// загрузить первые ответы и выборы вариантов подвопроса
+func (s *SubQuestionStat) load(db *sql.DB) error {
+	err := db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(is_right = 0), 0)
+		FROM AnswerEvent
+		WHERE id IN (
+			SELECT MIN(id) FROM AnswerEvent
+			WHERE sub_question_id = ? AND option_id != 0
+			GROUP BY user_id, nonce
+		)`, s.SubQuestionID).Scan(&s.Encounters, &s.FirstWrong)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`SELECT o.id, o.text, o.text = sq.text, COUNT(a.id)
+		FROM Option o
+		JOIN SubQuestion sq ON sq.id = o.sub_question_id
+		LEFT JOIN AnswerEvent a ON a.option_id = o.id
+		WHERE o.sub_question_id = ?
+		GROUP BY o.id
+		ORDER BY o.id`, s.SubQuestionID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var o OptionStat
+		if err := rows.Scan(&o.OptionID, &o.Text, &o.Right, &o.Picks); err != nil {
+			return err
+		}
+		s.Answers += o.Picks
+		s.Options = append(s.Options, o)
+	}
+	return rows.Err()
+}
+
+// DistractorText — отчёт для автора упражнения: по подвопросу доля неверных
+// первых ответов и выборы каждого неверного варианта, с флагами
+func DistractorText(title string, stats []SubQuestionStat) string {
+	var text strings.Builder
+	fmt.Fprintf(&text, "🔎 Варианты ответов «%s»", title)
+	if len(stats) == 0 {
+		text.WriteString("\nВ упражнении нет подвопросов с вариантами")
+		return text.String()
+	}
+	hard, unpicked := 0, 0
+	for _, s := range stats {
+		fmt.Fprintf(&text, "\n\n%s → %s", s.Question, strings.TrimSpace(s.Answer))
+		if s.Encounters == 0 {
+			text.WriteString("\n  ответов пока нет")
+			continue
+		}
+		fmt.Fprintf(&text, "\n  первых ответов: %d, неверных %d%%", s.Encounters, percent(s.FirstWrong, s.Encounters))
+		if s.TooHard() {
+			hard++
+			text.WriteString(" ❗ почти все ошибаются")
+		} else if !s.enough() {
+			text.WriteString(" (мало данных)")
+		}
+		for _, o := range s.Options {
+			if o.Right {
+				continue
+			}
+			fmt.Fprintf(&text, "\n  %s — %d из %d (%d%%)", o.Text, o.Picks, s.Answers, percent(o.Picks, s.Answers))
+		}
+		if never := s.Unpicked(); len(never) > 0 {
+			unpicked += len(never)
+			text.WriteString("\n  ⚠️ никто не выбирает: " + optionTexts(never))
+		}
+	}
+	fmt.Fprintf(&text, "\n\nИтого: слишком трудных подвопросов — %d, невыбираемых вариантов — %d", hard, unpicked)
+	return text.String()
+}
+
+// тексты вариантов через запятую
+func optionTexts(options []OptionStat) string {
+	texts := make([]string, len(options))
+	for i, o := range options {
+		texts[i] = o.Text
+	}
+	return strings.Join(texts, ", ")
+}
@@ -0,0 +1,325 @@
+// Package report собирает отчёты учителя по записанным ответам учеников
+// и выгружает их книгой Excel. Используется ботом (/report) и программой
+// cmd/report.
+package report
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// строк на листе «Частые ошибки»
+const maxMistakes = 50
+
+// Row — ученик в одном упражнении
+type Row struct {
+	UserID    int64
+	Student   string
+	Exercise  string
+	Attempts  int   // начатые попытки
+	Completed int   // завершённые попытки
+	Answers   int   // нажатия и введённые ответы
+	Right     int   // верные ответы
+	Hints     int   // ответы с подсказкой
+	Seconds   int64 // время завершённых попыток
+}
+
+// Mistake — неверный вариант и сколько раз его выбрали
+type Mistake struct {
+	Exercise string
+	Question string
+	Answer   string // верный текст подвопроса
+	Option   string
+	Picks    int
+}
+
+// Report — данные отчёта по ученикам и упражнениям среза
+type Report struct {
+	Title    string
+	Rows     []Row
+	Mistakes []Mistake
+}
+
+// ForClassroom — отчёт по ученикам класса и заданным ему упражнениям
+// (упражнения курсов разворачиваются). Учитываются все ответы учеников.
+func ForClassroom(db *sql.DB, classroomID int64) (*Report, error) {
+	r := &Report{}
+	err := db.QueryRow(`SELECT title FROM Classroom WHERE id = ?`, classroomID).Scan(&r.Title)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("класс %d не найден", classroomID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	users, err := queryIDs(db, `SELECT user_id FROM ClassroomMember WHERE classroom_id = ? ORDER BY joined_at, user_id`, classroomID)
+	if err != nil {
+		return nil, err
+	}
+	exercises, err := queryIDs(db, `SELECT exercise_id FROM (
+			SELECT a.exercise_id, a.id AS assignment, 0 AS unit, 0 AS position
+			FROM Assignment a WHERE a.classroom_id = ? AND a.exercise_id != 0
+			UNION ALL
+			SELECT ce.exercise_id, a.id, u.position, ce.position
+			FROM Assignment a
+			JOIN CourseUnit u ON u.course_id = a.course_id
+			JOIN CourseExercise ce ON ce.unit_id = u.id
+			WHERE a.classroom_id = ? AND a.course_id != 0
+		)
+		GROUP BY exercise_id
+		ORDER BY MIN(assignment), MIN(unit), MIN(position)`, classroomID, classroomID)
+	if err != nil {
+		return nil, err
+	}
+	return r, r.fill(db, users, exercises)
+}
+
+// ForExercise — отчёт по ученикам, которые отвечали в упражнении. teacherID —
+// только ученики классов этого учителя, 0 — все ученики
+func ForExercise(db *sql.DB, exerciseID int64, teacherID int64) (*Report, error) {
+	r := &Report{}
+	err := db.QueryRow(`SELECT title FROM Exercise WHERE id = ?`, exerciseID).Scan(&r.Title)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("упражнение %d не найдено", exerciseID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	users, err := queryIDs(db, `SELECT a.user_id FROM AnswerEvent a
+		WHERE a.exercise_id = ? AND a.nonce != 0
+		  AND (? = 0 OR a.user_id IN (
+			SELECT m.user_id
+			FROM ClassroomMember m
+			JOIN Classroom c ON c.id = m.classroom_id
+			WHERE c.teacher_id = ?
+		  ))
+		GROUP BY a.user_id
+		ORDER BY MIN(a.created_at), a.user_id`, exerciseID, teacherID, teacherID)
+	if err != nil {
+		return nil, err
+	}
+	return r, r.fill(db, users, []int64{exerciseID})
+}
+
+// FileName — имя файла отчёта без символов, недопустимых в именах файлов
+func (r *Report) FileName() string {
+	title := strings.Map(func(c rune) rune {
+		if c < ' ' || strings.ContainsRune(`/\:*?"<>|`, c) {
+			return '_'
+		}
+		return c
+	}, strings.TrimSpace(r.Title))
+	if title == "" || strings.Trim(title, ".") == "" {
+		title = "без названия"
+	}
+	return "Отчёт — " + title + ".xlsx"
+}
+
+// собрать строки ученик × упражнение и частые ошибки
+func (r *Report) fill(db *sql.DB, users []int64, exercises []int64) error {
+	titles := make(map[int64]string)
+	for _, exerciseID := range exercises {
+		var title string
+		if err := db.QueryRow(`SELECT title FROM Exercise WHERE id = ?`, exerciseID).Scan(&title); err != nil {
+			return err
+		}
+		titles[exerciseID] = title
+	}
+	for _, userID := range users {
+		name, err := studentName(db, userID)
+		if err != nil {
+			return err
+		}
+		for _, exerciseID := range exercises {
+			row := Row{UserID: userID, Student: name, Exercise: titles[exerciseID]}
+			err := db.QueryRow(`SELECT
+					(SELECT COUNT(DISTINCT nonce) FROM AnswerEvent WHERE user_id = ? AND exercise_id = ? AND nonce != 0),
+					(SELECT COUNT(*) FROM ExerciseResult WHERE user_id = ? AND exercise_id = ?),
+					(SELECT COUNT(*) FROM AnswerEvent WHERE user_id = ? AND exercise_id = ? AND nonce != 0),
+					(SELECT COUNT(*) FROM AnswerEvent WHERE user_id = ? AND exercise_id = ? AND nonce != 0 AND is_right = 1),
+					(SELECT COUNT(*) FROM AnswerEvent WHERE user_id = ? AND exercise_id = ? AND nonce != 0 AND hint = 1),
+					(SELECT COALESCE(SUM(finished_at - started_at), 0) FROM ExerciseResult WHERE user_id = ? AND exercise_id = ?)`,
+				userID, exerciseID, userID, exerciseID, userID, exerciseID,
+				userID, exerciseID, userID, exerciseID, userID, exerciseID).
+				Scan(&row.Attempts, &row.Completed, &row.Answers, &row.Right, &row.Hints, &row.Seconds)
+			if err != nil {
+				return err
+			}
+			r.Rows = append(r.Rows, row)
+		}
+	}
+	mistakes, err := loadMistakes(db, users, exercises)
+	if err != nil {
+		return err
+	}
+	r.Mistakes = mistakes
+	return nil
+}
+
+// неверные варианты, выбранные учениками среза, от частых к редким
+func loadMistakes(db *sql.DB, users []int64, exercises []int64) ([]Mistake, error) {
+	if len(users) == 0 || len(exercises) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, 0, len(users)+len(exercises))
+	for _, id := range users {
+		args = append(args, id)
+	}
+	for _, id := range exercises {
+		args = append(args, id)
+	}
+	rows, err := db.Query(`SELECT e.title, q.text, sq.text, o.text, COUNT(*) AS picks
+		FROM AnswerEvent a
+		JOIN Option o ON o.id = a.option_id
+		JOIN SubQuestion sq ON sq.id = a.sub_question_id
+		JOIN Question q ON q.id = sq.question_id
+		JOIN Exercise e ON e.id = a.exercise_id
+		WHERE a.is_right = 0 AND a.option_id != 0 AND a.nonce != 0
+		  AND a.user_id IN (`+placeholders(len(users))+`)
+		  AND a.exercise_id IN (`+placeholders(len(exercises))+`)
+		GROUP BY a.option_id
+		ORDER BY picks DESC, a.option_id
+		LIMIT `+fmt.Sprint(maxMistakes), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var mistakes []Mistake
+	for rows.Next() {
+		var m Mistake
+		if err := rows.Scan(&m.Exercise, &m.Question, &m.Answer, &m.Option, &m.Picks); err != nil {
+			return nil, err
+		}
+		mistakes = append(mistakes, m)
+	}
+	return mistakes, rows.Err()
+}
+
+// Workbook — книга Excel с листами «Выполнение», «Точность», «Время»,
+// «Подсказки» и «Частые ошибки»
+func (r *Report) Workbook() (*excelize.File, error) {
+	f := excelize.NewFile()
+	sheets := []struct {
+		name   string
+		header []interface{}
+		row    func(Row) []interface{}
+	}{
+		{"Выполнение", []interface{}{"Ученик", "Упражнение", "Попыток", "Завершено", "Пройдено"}, func(row Row) []interface{} {
+			return []interface{}{row.Student, row.Exercise, row.Attempts, row.Completed, yesNo(row.Completed > 0)}
+		}},
+		{"Точность", []interface{}{"Ученик", "Упражнение", "Ответов", "Верных", "Точность, %"}, func(row Row) []interface{} {
+			return []interface{}{row.Student, row.Exercise, row.Answers, row.Right, percent(row.Right, row.Answers)}
+		}},
+		{"Время", []interface{}{"Ученик", "Упражнение", "Завершено", "Минут всего", "Минут на попытку"}, func(row Row) []interface{} {
+			perAttempt := 0.0
+			if row.Completed > 0 {
+				perAttempt = minutes(row.Seconds / int64(row.Completed))
+			}
+			return []interface{}{row.Student, row.Exercise, row.Completed, minutes(row.Seconds), perAttempt}
+		}},
+		{"Подсказки", []interface{}{"Ученик", "Упражнение", "Ответов", "С подсказкой"}, func(row Row) []interface{} {
+			return []interface{}{row.Student, row.Exercise, row.Answers, row.Hints}
+		}},
+	}
+	for i, sheet := range sheets {
+		if i == 0 {
+			if err := f.SetSheetName(f.GetSheetName(0), sheet.name); err != nil {
+				return nil, err
+			}
+		} else if _, err := f.NewSheet(sheet.name); err != nil {
+			return nil, err
+		}
+		table := [][]interface{}{sheet.header}
+		for _, row := range r.Rows {
+			table = append(table, sheet.row(row))
+		}
+		if err := writeTable(f, sheet.name, table); err != nil {
+			return nil, err
+		}
+	}
+
+	const mistakesSheet = "Частые ошибки"
+	if _, err := f.NewSheet(mistakesSheet); err != nil {
+		return nil, err
+	}
+	table := [][]interface{}{{"Упражнение", "Вопрос", "Верно", "Выбранный вариант", "Раз"}}
+	for _, m := range r.Mistakes {
+		table = append(table, []interface{}{m.Exercise, m.Question, strings.TrimSpace(m.Answer), m.Option, m.Picks})
+	}
+	if err := writeTable(f, mistakesSheet, table); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// записать таблицу с первой строки листа
+func writeTable(f *excelize.File, sheet string, table [][]interface{}) error {
+	for i, values := range table {
+		cell, err := excelize.CoordinatesToCellName(1, i+1)
+		if err != nil {
+			return err
+		}
+		if err := f.SetSheetRow(sheet, cell, &values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// имя ученика для отчёта
+func studentName(db *sql.DB, userID int64) (string, error) {
+	var name string
+	err := db.QueryRow(`SELECT name FROM User WHERE id = ?`, userID).Scan(&name)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if name == "" {
+		name = fmt.Sprintf("id %d", userID)
+	}
+	return name, nil
+}
+
+// id по запросу в порядке строк
+func queryIDs(db *sql.DB, query string, args ...interface{}) ([]int64, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// "?, ?, ?" для IN (...)
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "да"
+	}
+	return "нет"
+}
+
+// доля в процентах; 0 ответов — 0
+func percent(part, total int) int {
+	if total == 0 {
+		return 0
+	}
+	return part * 100 / total
+}
+
+// секунды в минутах с одним знаком после запятой
+func minutes(seconds int64) float64 {
+	return float64(seconds*10/60) / 10
+}
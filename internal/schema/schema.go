@@ -0,0 +1,265 @@
+// Package schema создаёт и дополняет таблицы базы бота.
+// Используется и ботом, и ExcelParser, чтобы обе программы работали
+// с одной и той же схемой.
+package schema
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Служебные таблицы бота. Учебные таблицы (Exercise, Question, SubQuestion,
+// Option) создаются по docs/SQLInit.txt и заполняются ExcelParser;
+// новые колонки учебных таблиц добавляются здесь же (columns).
+var statements = []string{
+	// произвольные значения состояния бота (offset getUpdates и т.п.)
+	`CREATE TABLE IF NOT EXISTS BotState (
+		key   TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	)`,
+	// недавно обработанные update_id для защиты от повторной доставки
+	`CREATE TABLE IF NOT EXISTS ProcessedUpdate (
+		update_id    INTEGER PRIMARY KEY,
+		processed_at INTEGER NOT NULL
+	)`,
+	// пользователи бота, их роль и язык интерфейса
+	`CREATE TABLE IF NOT EXISTS User (
+		id         INTEGER PRIMARY KEY, -- id пользователя Telegram
+		role       TEXT NOT NULL DEFAULT 'student',
+		language   TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL
+	)`,
+	// текущая сессия упражнения пользователя; nonce попадает в подпись кнопок
+	`CREATE TABLE IF NOT EXISTS ExerciseSession (
+		user_id     INTEGER PRIMARY KEY,
+		exercise_id INTEGER NOT NULL,
+		nonce       INTEGER NOT NULL,
+		started_at  INTEGER NOT NULL
+	)`,
+	// каждый ответ ученика на подвопрос
+	`CREATE TABLE IF NOT EXISTS AnswerEvent (
+		id              INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id         INTEGER NOT NULL,
+		exercise_id     INTEGER NOT NULL,
+		nonce           INTEGER NOT NULL, -- сессия, в которой дан ответ
+		sub_question_id INTEGER NOT NULL,
+		option_id       INTEGER NOT NULL,
+		is_right        INTEGER NOT NULL,
+		created_at      INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_answer_event_user ON AnswerEvent(user_id, exercise_id)`,
+	// завершённые попытки прохождения упражнения
+	`CREATE TABLE IF NOT EXISTS ExerciseResult (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id       INTEGER NOT NULL,
+		exercise_id   INTEGER NOT NULL,
+		nonce         INTEGER NOT NULL,
+		started_at    INTEGER NOT NULL,
+		finished_at   INTEGER NOT NULL,
+		answers       INTEGER NOT NULL, -- всего нажатий на варианты
+		right_answers INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_exercise_result_user ON ExerciseResult(user_id, exercise_id)`,
+	// упражнения, открытые пользователю вручную в обход требований
+	`CREATE TABLE IF NOT EXISTS ExerciseUnlock (
+		user_id     INTEGER NOT NULL,
+		exercise_id INTEGER NOT NULL,
+		unlocked_by INTEGER NOT NULL,
+		created_at  INTEGER NOT NULL,
+		PRIMARY KEY (user_id, exercise_id)
+	)`,
+	// курсы: цепочки упражнений, сгруппированные в юниты
+	`CREATE TABLE IF NOT EXISTS Course (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		title        TEXT NOT NULL UNIQUE,
+		description  TEXT NOT NULL DEFAULT '',
+		position     INTEGER NOT NULL DEFAULT 0,
+		auto_advance INTEGER NOT NULL DEFAULT 0 -- 1: следующее упражнение запускается сразу
+	)`,
+	`CREATE TABLE IF NOT EXISTS CourseUnit (
+		id        INTEGER PRIMARY KEY AUTOINCREMENT,
+		course_id INTEGER NOT NULL,
+		position  INTEGER NOT NULL,
+		title     TEXT NOT NULL,
+		FOREIGN KEY (course_id) REFERENCES Course(id) ON DELETE CASCADE
+	)`,
+	`CREATE TABLE IF NOT EXISTS CourseExercise (
+		unit_id     INTEGER NOT NULL,
+		exercise_id INTEGER NOT NULL,
+		position    INTEGER NOT NULL,
+		PRIMARY KEY (unit_id, exercise_id),
+		FOREIGN KEY (unit_id) REFERENCES CourseUnit(id) ON DELETE CASCADE,
+		FOREIGN KEY (exercise_id) REFERENCES Exercise(id) ON DELETE CASCADE
+	)`,
+	// план вопросов текущей попытки: порядок, в котором их задаёт бот
+	`CREATE TABLE IF NOT EXISTS SessionQuestion (
+		user_id     INTEGER NOT NULL,
+		nonce       INTEGER NOT NULL,
+		position    INTEGER NOT NULL,
+		question_id INTEGER NOT NULL,
+		PRIMARY KEY (user_id, nonce, position)
+	)`,
+	// какие вопросы ученик уже видел и сколько раз
+	`CREATE TABLE IF NOT EXISTS SeenQuestion (
+		user_id      INTEGER NOT NULL,
+		question_id  INTEGER NOT NULL,
+		seen_count   INTEGER NOT NULL,
+		last_seen_at INTEGER NOT NULL,
+		PRIMARY KEY (user_id, question_id)
+	)`,
+	// текущий курс ученика (для /continue)
+	`CREATE TABLE IF NOT EXISTS UserCourse (
+		user_id    INTEGER PRIMARY KEY,
+		course_id  INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	)`,
+	// раунды викторины в групповых чатах
+	`CREATE TABLE IF NOT EXISTS QuizRound (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat_id     INTEGER NOT NULL,
+		exercise_id INTEGER NOT NULL,
+		started_at  INTEGER NOT NULL,
+		finished_at INTEGER -- NULL, пока раунд идёт
+	)`,
+	// опросы-викторины раунда: один опрос на подвопрос
+	`CREATE TABLE IF NOT EXISTS QuizPoll (
+		poll_id         TEXT PRIMARY KEY, -- id опроса Telegram
+		round_id        INTEGER NOT NULL,
+		position        INTEGER NOT NULL,
+		sub_question_id INTEGER NOT NULL,
+		message_id      INTEGER NOT NULL,
+		correct_option  INTEGER NOT NULL, -- индекс верного варианта в опросе
+		option_ids      TEXT NOT NULL,    -- Option.id вариантов в порядке опроса, через запятую
+		FOREIGN KEY (round_id) REFERENCES QuizRound(id) ON DELETE CASCADE
+	)`,
+	// ответы участников на опросы; учитывается первый ответ
+	`CREATE TABLE IF NOT EXISTS QuizAnswer (
+		poll_id      TEXT NOT NULL,
+		user_id      INTEGER NOT NULL,
+		option_index INTEGER NOT NULL,
+		is_right     INTEGER NOT NULL,
+		created_at   INTEGER NOT NULL,
+		PRIMARY KEY (poll_id, user_id)
+	)`,
+	// дуэли: два ученика проходят одно упражнение с общим планом вопросов
+	`CREATE TABLE IF NOT EXISTS Duel (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		code        TEXT NOT NULL UNIQUE, -- код приглашения
+		exercise_id INTEGER NOT NULL,
+		status      TEXT NOT NULL,        -- waiting, active, finished, cancelled
+		created_at  INTEGER NOT NULL,
+		started_at  INTEGER,
+		finished_at INTEGER,
+		winner_id   INTEGER               -- 0 — ничья
+	)`,
+	// участники дуэли и их попытки
+	`CREATE TABLE IF NOT EXISTS DuelPlayer (
+		duel_id     INTEGER NOT NULL,
+		user_id     INTEGER NOT NULL,
+		chat_id     INTEGER NOT NULL,
+		nonce       INTEGER NOT NULL DEFAULT 0, -- попытка в ExerciseSession; 0 — ещё не начата
+		finished_at INTEGER,                    -- NULL, пока ученик отвечает
+		PRIMARY KEY (duel_id, user_id),
+		FOREIGN KEY (duel_id) REFERENCES Duel(id) ON DELETE CASCADE
+	)`,
+	// общий план вопросов дуэли
+	`CREATE TABLE IF NOT EXISTS DuelQuestion (
+		duel_id     INTEGER NOT NULL,
+		position    INTEGER NOT NULL,
+		question_id INTEGER NOT NULL,
+		PRIMARY KEY (duel_id, position),
+		FOREIGN KEY (duel_id) REFERENCES Duel(id) ON DELETE CASCADE
+	)`,
+	// классы учителей
+	`CREATE TABLE IF NOT EXISTS Classroom (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		title      TEXT NOT NULL,
+		teacher_id INTEGER NOT NULL,
+		code       TEXT NOT NULL UNIQUE, -- код для вступления учеников
+		created_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS ClassroomMember (
+		classroom_id INTEGER NOT NULL,
+		user_id      INTEGER NOT NULL,
+		joined_at    INTEGER NOT NULL,
+		PRIMARY KEY (classroom_id, user_id),
+		FOREIGN KEY (classroom_id) REFERENCES Classroom(id) ON DELETE CASCADE
+	)`,
+	// задания класса: упражнение или курс со сроком
+	`CREATE TABLE IF NOT EXISTS Assignment (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		classroom_id INTEGER NOT NULL,
+		exercise_id  INTEGER NOT NULL DEFAULT 0, -- 0 — задан курс
+		course_id    INTEGER NOT NULL DEFAULT 0,
+		deadline     INTEGER NOT NULL DEFAULT 0, -- конец дня срока; 0 — без срока
+		created_at   INTEGER NOT NULL,
+		FOREIGN KEY (classroom_id) REFERENCES Classroom(id) ON DELETE CASCADE
+	)`,
+}
+
+// Колонки, добавленные к уже существующим таблицам
+var columns = []struct {
+	table, column, decl string
+}{
+	{"Exercise", "topic", "TEXT NOT NULL DEFAULT ''"},
+	{"ExerciseSession", "finished_at", "INTEGER"},
+	{"Exercise", "level", "INTEGER NOT NULL DEFAULT 0"},    // уровень сложности, 0 — не задан
+	{"Exercise", "position", "INTEGER NOT NULL DEFAULT 0"}, // порядок внутри уровня
+	{"Exercise", "description", "TEXT NOT NULL DEFAULT ''"},
+	{"Exercise", "question_count", "INTEGER NOT NULL DEFAULT 0"},   // вопросов за попытку из пула, 0 — все по порядку
+	{"Exercise", "unlock_accuracy", "INTEGER NOT NULL DEFAULT 0"},  // % точности на предыдущем уровне, 0 — открыто всегда
+	{"SubQuestion", "joiner", "TEXT NOT NULL DEFAULT ''"},          // как часть присоединяется к предложению: word, suffix, punct, clause
+	{"Exercise", "answer_mode", "TEXT NOT NULL DEFAULT ''"},        // words, sentence — ответ вводится текстом; пусто — кнопки
+	{"ExerciseSession", "sub_question_id", "INTEGER"},              // подвопрос, ответ на который ждём текстом
+	{"ExerciseSession", "message_id", "INTEGER"},                   // сообщение с вопросом для режима ввода
+	{"ExerciseSession", "compose", "TEXT NOT NULL DEFAULT ''"},     // набранная часть ответа в режиме ввода
+	{"AnswerEvent", "answer_text", "TEXT NOT NULL DEFAULT ''"},     // введённый текст; option_id = 0
+	{"User", "script", "TEXT NOT NULL DEFAULT 'cyrl'"},             // письменность татарского текста: cyrl, latn
+	{"SubQuestion", "direction", "TEXT NOT NULL DEFAULT 'tt'"},     // tt — собирается татарский перевод, ru — русский (обратное направление)
+	{"ExerciseSession", "direction", "TEXT NOT NULL DEFAULT 'tt'"}, // направление текущей попытки
+	{"ExerciseSession", "practice", "TEXT NOT NULL DEFAULT ''"},    // order — попытка в режиме «порядок слов»
+	{"User", "name", "TEXT NOT NULL DEFAULT ''"},                   // имя из Telegram для таблиц результатов
+	{"Exercise", "type", "TEXT NOT NULL DEFAULT ''"},               // тип упражнения: пусто — сборка перевода, order, match, cloze, choice
+	{"SubQuestion", "prompt", "TEXT NOT NULL DEFAULT ''"},          // левая часть пары (тип match)
+	{"AnswerEvent", "hint", "INTEGER NOT NULL DEFAULT 0"},          // 1 — ответ с подсказкой: замена татарских букв или «почти»
+}
+
+// Ensure создаёт недостающие таблицы и колонки
+func Ensure(db *sql.DB) error {
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("создание схемы: %w", err)
+		}
+	}
+	for _, col := range columns {
+		if err := ensureColumn(db, col.table, col.column, col.decl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// добавить колонку, если её ещё нет
+func ensureColumn(db *sql.DB, table, column, decl string) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + decl); err != nil {
+		return fmt.Errorf("добавление колонки %s.%s: %w", table, column, err)
+	}
+	return nil
+}